@@ -1,4 +1,4 @@
-/* 加入了事件，请把此文件，调换掉fabric-samples项目中的同名文件 */
+/* 加入了事件，请把此文件，调换掉fabric-samples项目中的同名文件，并把META-INF目录复制到同一目录 */
 
 /*
 Copyright IBM Corp. 2016 All Rights Reserved.
@@ -25,9 +25,12 @@ package main
 //hard-coding.
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
 )
@@ -36,6 +39,304 @@ import (
 type SimpleChaincode struct {
 }
 
+// Event names and payloads, keep them same as package chaincode/types of
+// the sdk side, which decodes the payloads. They replace InvokeEvent and
+// DeleteEvent, a transaction keeps only its last event, so the old names
+// are not emitted anymore.
+const (
+	TransferEvent = "Transfer"
+	DeletedEvent  = "Deleted"
+)
+
+// Transfer is the payload of TransferEvent, Balances is the balances of
+// From and To after transfer
+type Transfer struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Amount   int            `json:"amount"`
+	Balances map[string]int `json:"balances"`
+}
+
+// Deleted is the payload of DeletedEvent
+type Deleted struct {
+	Key string `json:"key"`
+}
+
+// HistoryEntry is a value of key in history, Value is empty if the key was
+// deleted by the transaction
+type HistoryEntry struct {
+	TxID      string    `json:"txId"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// Accounts are stored as json Account under composite keys of
+// AccountObjectType, DocType of Account is AccountObjectType, so rich
+// queries can select accounts by it.
+const AccountObjectType = "account"
+
+// Account is the state of account, Updated is the time of the last
+// transaction that writes it
+type Account struct {
+	DocType  string            `json:"docType"`
+	Name     string            `json:"name"`
+	Balance  int               `json:"balance"`
+	Owner    Owner             `json:"owner"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Updated  time.Time         `json:"updated"`
+}
+
+// Callers with attribute AdminAttribute of value AdminRole can debit and
+// delete any account
+const (
+	AdminAttribute = "role"
+	AdminRole      = "admin"
+)
+
+// Owner is the owner of account, only the owner can debit or delete the
+// account. Empty Subject means any member of MSPID, e.g. the accounts of
+// Init. Empty MSPID means no owner, only admins can debit or delete it.
+type Owner struct {
+	MSPID   string `json:"mspId"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// AccountPage is a page of accounts, Bookmark is used to query the next
+// page, it's empty if there is no more accounts
+type AccountPage struct {
+	Accounts []Account `json:"accounts"`
+	Bookmark string    `json:"bookmark"`
+}
+
+func accountKey(stub shim.ChaincodeStubInterface, name string) (string, error) {
+	return stub.CreateCompositeKey(AccountObjectType, []string{name})
+}
+
+// getAccount returns account name, nil if the account does not exist
+func getAccount(stub shim.ChaincodeStubInterface, name string) (*Account, error) {
+	key, err := accountKey(stub, name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := stub.GetState(key)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	a := &Account{}
+	if err := json.Unmarshal(val, a); err != nil {
+		return nil, fmt.Errorf("invalid account %s", name)
+	}
+	return a, nil
+}
+
+// putAccount writes account a, DocType and Updated are set by it
+func putAccount(stub shim.ChaincodeStubInterface, a *Account) error {
+	key, err := accountKey(stub, a.Name)
+	if err != nil {
+		return err
+	}
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return err
+	}
+	a.DocType = AccountObjectType
+	a.Updated = time.Unix(ts.Seconds, int64(ts.Nanos)).UTC()
+
+	accountBytes, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, accountBytes)
+}
+
+// createAccount creates account a, it fails if the account exists
+func createAccount(stub shim.ChaincodeStubInterface, a *Account) error {
+	if a.Name == "" {
+		return newError(ErrCodeInvalidArgument, "empty account name")
+	}
+	if old, err := getAccount(stub, a.Name); err != nil {
+		return err
+	} else if old != nil {
+		return newError(ErrCodeInvalidArgument, "account %s exists", a.Name).with("account", a.Name)
+	}
+	return putAccount(stub, a)
+}
+
+// caller returns the identity of the creator of transaction as owner, and
+// whether it has admin role
+func caller(stub shim.ChaincodeStubInterface) (Owner, bool, error) {
+	id, err := cid.New(stub)
+	if err != nil {
+		return Owner{}, false, err
+	}
+	mspID, err := id.GetMSPID()
+	if err != nil {
+		return Owner{}, false, err
+	}
+	cert, err := id.GetX509Certificate()
+	if err != nil {
+		return Owner{}, false, err
+	}
+	role, found, err := id.GetAttributeValue(AdminAttribute)
+	if err != nil {
+		return Owner{}, false, err
+	}
+	return Owner{MSPID: mspID, Subject: cert.Subject.String()}, found && role == AdminRole, nil
+}
+
+// authorize checks the caller can do action on account a, only the owner
+// and admins are allowed. Accounts without owner, e.g. written before
+// accounts had owners, are allowed to admins only.
+func authorize(stub shim.ChaincodeStubInterface, a *Account, action string) error {
+	name, owner := a.Name, a.Owner
+
+	c, admin, err := caller(stub)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller identity: %v", err)
+	}
+	if admin {
+		return nil
+	}
+	if owner.MSPID != "" && c.MSPID == owner.MSPID && (owner.Subject == "" || owner.Subject == c.Subject) {
+		return nil
+	}
+	return newError(ErrCodeUnauthorized, "%q of %s is not the owner of account %s, only the owner or %s=%s can %s it",
+		c.Subject, c.MSPID, name, AdminAttribute, AdminRole, action).
+		with("account", name).with("mspId", c.MSPID).with("subject", c.Subject).with("action", action)
+}
+
+// Error codes of failed responses, the message of response is json
+// ErrorEnvelope
+const (
+	ErrCodeInternal          = "INTERNAL"
+	ErrCodeUnknownFunction   = "UNKNOWN_FUNCTION"
+	ErrCodeInvalidArgument   = "INVALID_ARGUMENT"
+	ErrCodeInvalidAmount     = "INVALID_AMOUNT"
+	ErrCodeAmountTooLarge    = "AMOUNT_TOO_LARGE"
+	ErrCodeInsufficientFunds = "INSUFFICIENT_FUNDS"
+	ErrCodeNotFound          = "NOT_FOUND"
+	ErrCodeUnauthorized      = "UNAUTHORIZED"
+)
+
+// ErrorEnvelope is the message of all failed responses, Details has the
+// values related to the error, e.g. the balance of INSUFFICIENT_FUNDS
+type ErrorEnvelope struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// codeError is an error with error code
+type codeError struct {
+	ErrorEnvelope
+}
+
+func (e *codeError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// with adds detail key of the error
+func (e *codeError) with(key string, v interface{}) *codeError {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = v
+	return e
+}
+
+func newError(code, format string, args ...interface{}) *codeError {
+	return &codeError{ErrorEnvelope{Code: code, Message: fmt.Sprintf(format, args...)}}
+}
+
+// errorResponse returns failed response of err, errors without code are
+// INTERNAL
+func errorResponse(err error) pb.Response {
+	e, ok := err.(*codeError)
+	if !ok {
+		e = newError(ErrCodeInternal, "%v", err)
+	}
+	msg, merr := json.Marshal(e.ErrorEnvelope)
+	if merr != nil {
+		// never happens, the details are plain values
+		return shim.Error(e.Error())
+	}
+	return shim.Error(string(msg))
+}
+
+// errorf returns failed response with error code
+func errorf(code, format string, args ...interface{}) pb.Response {
+	return errorResponse(newError(code, format, args...))
+}
+
+// Config is the limits of transfer configured at Init, balance can be
+// negative down to -OverdraftLimit, and the amount of a transfer can't be
+// greater than MaxAmount
+type Config struct {
+	OverdraftLimit int `json:"overdraftLimit"`
+	MaxAmount      int `json:"maxAmount"`
+}
+
+// ConfigObjectType is the composite key of Config
+const ConfigObjectType = "config"
+
+// DefaultMaxAmount is the MaxAmount if Init doesn't set it
+const DefaultMaxAmount = 1000000
+
+const maxInt = int(^uint(0) >> 1)
+
+func getConfig(stub shim.ChaincodeStubInterface) (Config, error) {
+	cfg := Config{MaxAmount: DefaultMaxAmount}
+	key, err := stub.CreateCompositeKey(ConfigObjectType, []string{})
+	if err != nil {
+		return cfg, err
+	}
+	val, err := stub.GetState(key)
+	if err != nil || val == nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(val, &cfg)
+	return cfg, err
+}
+
+func putConfig(stub shim.ChaincodeStubInterface, cfg Config) error {
+	key, err := stub.CreateCompositeKey(ConfigObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	cfgBytes, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, cfgBytes)
+}
+
+// parseAmount parses s as an amount between 0 and max
+func parseAmount(s string, max int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, newError(ErrCodeInvalidAmount, "expecting integer amount, got %q", s).with("amount", s)
+	}
+	if n < 0 {
+		return 0, newError(ErrCodeInvalidAmount, "amount %d is negative", n).with("amount", n)
+	}
+	if n > max {
+		return 0, newError(ErrCodeAmountTooLarge, "amount %d is greater than %d", n, max).
+			with("amount", n).with("max", max)
+	}
+	return n, nil
+}
+
+// setEvent sets json payload v as event name, a transaction can only have
+// one event, the last one is kept
+func setEvent(stub shim.ChaincodeStubInterface, name string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(name, payload)
+}
+
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	fmt.Println("ex02 Init")
 	_, args := stub.GetFunctionAndParameters()
@@ -43,32 +344,53 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	var Aval, Bval int // Asset holdings
 	var err error
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	// The optional 5th and 6th args are the overdraft limit and max amount
+	if len(args) < 4 || len(args) > 6 {
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting 4 to 6")
 	}
 
 	// Initialize the chaincode
 	A = args[0]
-	Aval, err = strconv.Atoi(args[1])
+	Aval, err = parseAmount(args[1], maxInt)
 	if err != nil {
-		return shim.Error("Expecting integer value for asset holding")
+		return errorResponse(err)
 	}
 	B = args[2]
-	Bval, err = strconv.Atoi(args[3])
+	Bval, err = parseAmount(args[3], maxInt)
 	if err != nil {
-		return shim.Error("Expecting integer value for asset holding")
+		return errorResponse(err)
 	}
 	fmt.Printf("Aval = %d, Bval = %d\n", Aval, Bval)
 
-	// Write the state to the ledger
-	err = stub.PutState(A, []byte(strconv.Itoa(Aval)))
-	if err != nil {
-		return shim.Error(err.Error())
+	cfg := Config{MaxAmount: DefaultMaxAmount}
+	if len(args) > 4 {
+		if cfg.OverdraftLimit, err = parseAmount(args[4], maxInt); err != nil {
+			return errorResponse(err)
+		}
+	}
+	if len(args) > 5 {
+		if cfg.MaxAmount, err = parseAmount(args[5], maxInt); err != nil {
+			return errorResponse(err)
+		}
+	}
+	if err = putConfig(stub, cfg); err != nil {
+		return errorResponse(err)
 	}
 
-	err = stub.PutState(B, []byte(strconv.Itoa(Bval)))
+	// The accounts are owned by the members of the msp of instantiator
+	c, _, err := caller(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorf(ErrCodeInternal, "Failed to get caller identity: %v", err)
+	}
+	owner := Owner{MSPID: c.MSPID}
+
+	// Write the state to the ledger, upgrade resets them
+	if err = putAccount(stub, &Account{Name: A, Balance: Aval, Owner: owner}); err != nil {
+		return errorResponse(err)
+	}
+
+	if err = putAccount(stub, &Account{Name: B, Balance: Bval, Owner: owner}); err != nil {
+		return errorResponse(err)
 	}
 
 	var as []byte
@@ -90,20 +412,35 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	}
 
 	if function == "invoke" {
-		stub.SetEvent("InvokeEvent", as)
 		// Make payment of X units from A to B
 		return t.invoke(stub, args)
 	} else if function == "delete" {
-		stub.SetEvent("DeleteEvent", as)
 		// Deletes an entity from its state
 		return t.delete(stub, args)
 	} else if function == "query" {
 		stub.SetEvent("QueryEvent", as)
 		// the old "Query" is now implemtned in invoke
 		return t.query(stub, args)
+	} else if function == "history" {
+		// Returns all values of an entity in history
+		return t.history(stub, args)
+	} else if function == "create" {
+		// Creates a new entity with initial balance, owned by caller
+		return t.create(stub, args)
+	} else if function == "list" {
+		// Returns a page of entities
+		return t.list(stub, args)
+	} else if function == "queryByOwner" {
+		// Returns a page of entities of owner by rich query
+		return t.queryByOwner(stub, args)
+	} else if function == "queryRange" {
+		// Returns a page of entities in balance range by rich query
+		return t.queryRange(stub, args)
 	}
 
-	return shim.Error("Invalid invoke function name. Expecting \"invoke\" \"delete\" \"query\"")
+	return errorResponse(newError(ErrCodeUnknownFunction,
+		"Invalid invoke function name. Expecting \"invoke\" \"delete\" \"query\" \"history\" \"create\" \"list\" \"queryByOwner\" \"queryRange\"").
+		with("function", function))
 }
 
 // Transaction makes payment of X units from A to B
@@ -114,50 +451,82 @@ func (t *SimpleChaincode) invoke(stub shim.ChaincodeStubInterface, args []string
 	var err error
 
 	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting 3")
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting 3")
 	}
 
 	A = args[0]
 	B = args[1]
+	if A == B {
+		return errorf(ErrCodeInvalidArgument, "Can't transfer from %s to itself", A)
+	}
 
-	// Get the state from the ledger
-	// TODO: will be nice to have a GetAllState call to ledger
-	Avalbytes, err := stub.GetState(A)
+	cfg, err := getConfig(stub)
 	if err != nil {
-		return shim.Error("Failed to get state")
+		return errorf(ErrCodeInternal, "Failed to get config")
 	}
-	if Avalbytes == nil {
-		return shim.Error("Entity not found")
+	X, err = parseAmount(args[2], cfg.MaxAmount)
+	if err != nil {
+		return errorResponse(err)
 	}
-	Aval, _ = strconv.Atoi(string(Avalbytes))
 
-	Bvalbytes, err := stub.GetState(B)
+	// Get the state from the ledger
+	Aaccount, err := getAccount(stub, A)
 	if err != nil {
-		return shim.Error("Failed to get state")
+		return errorf(ErrCodeInternal, "Failed to get state")
 	}
-	if Bvalbytes == nil {
-		return shim.Error("Entity not found")
+	if Aaccount == nil {
+		return errorResponse(newError(ErrCodeNotFound, "Entity %s not found", A).with("account", A))
 	}
-	Bval, _ = strconv.Atoi(string(Bvalbytes))
+	Aval = Aaccount.Balance
 
-	// Perform the execution
-	X, err = strconv.Atoi(args[2])
+	Baccount, err := getAccount(stub, B)
 	if err != nil {
-		return shim.Error("Invalid transaction amount, expecting a integer value")
+		return errorf(ErrCodeInternal, "Failed to get state")
+	}
+	if Baccount == nil {
+		return errorResponse(newError(ErrCodeNotFound, "Entity %s not found", B).with("account", B))
+	}
+	Bval = Baccount.Balance
+
+	// Only the owner can move funds out of account
+	if err := authorize(stub, Aaccount, "debit"); err != nil {
+		return errorResponse(err)
+	}
+
+	// Perform the execution, Aval - X >= -OverdraftLimit
+	if Aval < X-cfg.OverdraftLimit {
+		return errorResponse(newError(ErrCodeInsufficientFunds, "Balance %d of %s is not enough for %d, overdraft limit is %d",
+			Aval, A, X, cfg.OverdraftLimit).
+			with("account", A).with("balance", Aval).with("amount", X).with("overdraftLimit", cfg.OverdraftLimit))
+	}
+	if Bval > maxInt-X {
+		return errorResponse(newError(ErrCodeAmountTooLarge, "Balance of %s overflows", B).with("account", B))
 	}
 	Aval = Aval - X
 	Bval = Bval + X
 	fmt.Printf("Aval = %d, Bval = %d\n", Aval, Bval)
 
 	// Write the state back to the ledger
-	err = stub.PutState(A, []byte(strconv.Itoa(Aval)))
+	Aaccount.Balance = Aval
+	err = putAccount(stub, Aaccount)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	Baccount.Balance = Bval
+	err = putAccount(stub, Baccount)
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorResponse(err)
 	}
 
-	err = stub.PutState(B, []byte(strconv.Itoa(Bval)))
+	err = setEvent(stub, TransferEvent, Transfer{
+		From:     A,
+		To:       B,
+		Amount:   X,
+		Balances: map[string]int{A: Aval, B: Bval},
+	})
 	if err != nil {
-		return shim.Error(err.Error())
+		return errorf(ErrCodeInternal, "Failed to set event")
 	}
 
 	return shim.Success(nil)
@@ -166,15 +535,33 @@ func (t *SimpleChaincode) invoke(stub shim.ChaincodeStubInterface, args []string
 // Deletes an entity from state
 func (t *SimpleChaincode) delete(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting 1")
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting 1")
 	}
 
 	A := args[0]
 
+	account, err := getAccount(stub, A)
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to get state")
+	}
+	if account == nil {
+		return errorResponse(newError(ErrCodeNotFound, "Entity %s not found", A).with("account", A))
+	}
+	if err := authorize(stub, account, "delete"); err != nil {
+		return errorResponse(err)
+	}
+
 	// Delete the key from the state in ledger
-	err := stub.DelState(A)
+	key, err := accountKey(stub, A)
 	if err != nil {
-		return shim.Error("Failed to delete state")
+		return errorResponse(err)
+	}
+	if err := stub.DelState(key); err != nil {
+		return errorf(ErrCodeInternal, "Failed to delete state")
+	}
+
+	if err := setEvent(stub, DeletedEvent, Deleted{Key: A}); err != nil {
+		return errorf(ErrCodeInternal, "Failed to set event")
 	}
 
 	return shim.Success(nil)
@@ -186,28 +573,227 @@ func (t *SimpleChaincode) query(stub shim.ChaincodeStubInterface, args []string)
 	var err error
 
 	if len(args) != 1 {
-		return shim.Error("Incorrect number of arguments. Expecting name of the person to query")
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting name of the person to query")
 	}
 
 	A = args[0]
 
 	// Get the state from the ledger
-	Avalbytes, err := stub.GetState(A)
+	account, err := getAccount(stub, A)
 	if err != nil {
-		jsonResp := "{\"Error\":\"Failed to get state for " + A + "\"}"
-		return shim.Error(jsonResp)
+		return errorf(ErrCodeInternal, "Failed to get state for %s", A)
 	}
 
-	if Avalbytes == nil {
-		jsonResp := "{\"Error\":\"Nil amount for " + A + "\"}"
-		return shim.Error(jsonResp)
+	if account == nil {
+		return errorResponse(newError(ErrCodeNotFound, "Nil amount for %s", A).with("account", A))
 	}
 
+	// query returns the balance only, list and the rich queries return
+	// the accounts
+	Avalbytes := []byte(strconv.Itoa(account.Balance))
 	jsonResp := "{\"Name\":\"" + A + "\",\"Amount\":\"" + string(Avalbytes) + "\"}"
 	fmt.Printf("Query Response:%s\n", jsonResp)
 	return shim.Success(Avalbytes)
 }
 
+// history returns the values of an entity in history as json, oldest first
+func (t *SimpleChaincode) history(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting name of the person to query")
+	}
+
+	A := args[0]
+
+	key, err := accountKey(stub, A)
+	if err != nil {
+		return errorResponse(err)
+	}
+	iter, err := stub.GetHistoryForKey(key)
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to get history for %s", A)
+	}
+	defer iter.Close()
+
+	entries := []HistoryEntry{}
+	for iter.HasNext() {
+		m, err := iter.Next()
+		if err != nil {
+			return errorf(ErrCodeInternal, "Failed to iterate history for %s", A)
+		}
+
+		entry := HistoryEntry{
+			TxID:     m.TxId,
+			IsDelete: m.IsDelete,
+		}
+		if !m.IsDelete {
+			entry.Value = string(m.Value)
+		}
+		if m.Timestamp != nil {
+			entry.Timestamp = time.Unix(m.Timestamp.Seconds, int64(m.Timestamp.Nanos)).UTC()
+		}
+		entries = append(entries, entry)
+	}
+
+	historyBytes, err := json.Marshal(entries)
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to marshal history")
+	}
+	fmt.Printf("History of %s: %d entries\n", A, len(entries))
+	return shim.Success(historyBytes)
+}
+
+// create creates entity A with initial balance, the caller is the owner,
+// the optional 3rd arg is the metadata of account as json object of strings
+func (t *SimpleChaincode) create(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 && len(args) != 3 {
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting name, balance and optional metadata")
+	}
+
+	A := args[0]
+	Aval, err := parseAmount(args[1], maxInt)
+	if err != nil {
+		return errorResponse(err)
+	}
+	var metadata map[string]string
+	if len(args) == 3 && args[2] != "" {
+		if err := json.Unmarshal([]byte(args[2]), &metadata); err != nil {
+			return errorf(ErrCodeInvalidArgument, "Expecting json object of strings for metadata")
+		}
+	}
+
+	owner, _, err := caller(stub)
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to get caller identity: %v", err)
+	}
+	account := &Account{Name: A, Balance: Aval, Owner: owner, Metadata: metadata}
+	if err := createAccount(stub, account); err != nil {
+		return errorResponse(err)
+	}
+	fmt.Printf("Create %s: balance = %d, owner = %s of %s\n", A, Aval, owner.Subject, owner.MSPID)
+	return shim.Success(nil)
+}
+
+// list returns a page of entities ordered by name, args are page size and
+// the bookmark returned by last page, empty for the first page
+func (t *SimpleChaincode) list(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting page size and bookmark")
+	}
+
+	pageSize, err := strconv.Atoi(args[0])
+	if err != nil || pageSize <= 0 {
+		return errorf(ErrCodeInvalidArgument, "Expecting positive integer value for page size")
+	}
+
+	iter, meta, err := stub.GetStateByPartialCompositeKeyWithPagination(AccountObjectType, []string{}, int32(pageSize), args[1])
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to list accounts: %v", err)
+	}
+	return accountPage(iter, meta, pageSize)
+}
+
+// queryByOwner returns a page of entities owned by msp, args are msp id,
+// cert subject, page size and bookmark. Empty subject matches all owners
+// of the msp. It needs CouchDB. Accounts of Init have no subject, so they
+// are not in indexOwner, which is only used if subject is given.
+func (t *SimpleChaincode) queryByOwner(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting msp id, subject, page size and bookmark")
+	}
+
+	q := richQuery{
+		Selector: map[string]interface{}{
+			"docType":     AccountObjectType,
+			"owner.mspId": args[0],
+		},
+		UseIndex: []string{"_design/indexOwnerMspDoc", "indexOwnerMsp"},
+	}
+	if args[1] != "" {
+		q.Selector["owner.subject"] = args[1]
+		q.UseIndex = []string{"_design/indexOwnerDoc", "indexOwner"}
+	}
+	return queryAccounts(stub, q, args[2], args[3])
+}
+
+// queryRange returns a page of entities whose balance is in [min, max]
+// ordered by balance, args are min, max, page size and bookmark. It needs
+// CouchDB.
+func (t *SimpleChaincode) queryRange(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 4 {
+		return errorf(ErrCodeInvalidArgument, "Incorrect number of arguments. Expecting min, max, page size and bookmark")
+	}
+
+	min, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errorf(ErrCodeInvalidArgument, "Expecting integer value for min balance")
+	}
+	max, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errorf(ErrCodeInvalidArgument, "Expecting integer value for max balance")
+	}
+	return queryAccounts(stub, richQuery{
+		Selector: map[string]interface{}{
+			"docType": AccountObjectType,
+			"balance": map[string]interface{}{"$gte": min, "$lte": max},
+		},
+		Sort:     []map[string]string{{"docType": "asc"}, {"balance": "asc"}},
+		UseIndex: []string{"_design/indexBalanceDoc", "indexBalance"},
+	}, args[2], args[3])
+}
+
+// richQuery is CouchDB query, the indexes are in META-INF
+type richQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []map[string]string    `json:"sort,omitempty"`
+	UseIndex []string               `json:"use_index,omitempty"`
+}
+
+func queryAccounts(stub shim.ChaincodeStubInterface, q richQuery, pageSizeArg, bookmark string) pb.Response {
+	pageSize, err := strconv.Atoi(pageSizeArg)
+	if err != nil || pageSize <= 0 {
+		return errorf(ErrCodeInvalidArgument, "Expecting positive integer value for page size")
+	}
+	query, err := json.Marshal(q)
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to marshal query")
+	}
+
+	iter, meta, err := stub.GetQueryResultWithPagination(string(query), int32(pageSize), bookmark)
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to query accounts: %v", err)
+	}
+	return accountPage(iter, meta, pageSize)
+}
+
+// accountPage returns the accounts of iter as json AccountPage, and closes
+// iter
+func accountPage(iter shim.StateQueryIteratorInterface, meta *pb.QueryResponseMetadata, pageSize int) pb.Response {
+	defer iter.Close()
+
+	page := AccountPage{Accounts: []Account{}}
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return errorf(ErrCodeInternal, "Failed to iterate accounts")
+		}
+		account := Account{}
+		if err := json.Unmarshal(kv.Value, &account); err != nil {
+			return errorf(ErrCodeInternal, "Invalid account of key %s", kv.Key)
+		}
+		page.Accounts = append(page.Accounts, account)
+	}
+	// the bookmark of the last page points to the end
+	if meta != nil && int(meta.FetchedRecordsCount) == pageSize {
+		page.Bookmark = meta.Bookmark
+	}
+
+	pageBytes, err := json.Marshal(page)
+	if err != nil {
+		return errorf(ErrCodeInternal, "Failed to marshal accounts")
+	}
+	return shim.Success(pageBytes)
+}
+
 func main() {
 	err := shim.Start(new(SimpleChaincode))
 	if err != nil {
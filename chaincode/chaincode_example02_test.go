@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/shitaibin/fabric-sdk-go-sample/chaincode/mockstub"
+)
+
+const testMSP = "Org1MSP"
+
+// newStub creates stub of the chaincode initialized with accounts a and b,
+// the creator is user1 of testMSP
+func newStub(t *testing.T, initArgs ...string) *mockstub.Stub {
+	t.Helper()
+	stub := mockstub.New("ex02", new(SimpleChaincode))
+	setIdentity(t, stub, "user1", nil)
+	if len(initArgs) == 0 {
+		initArgs = []string{"a", "100", "b", "200"}
+	}
+	args := [][]byte{[]byte("init")}
+	for _, a := range initArgs {
+		args = append(args, []byte(a))
+	}
+	if resp := stub.MockInit("init", args); resp.Status != shim.OK {
+		t.Fatalf("init error: %s", resp.Message)
+	}
+	stub.Events()
+	return stub
+}
+
+func setIdentity(t *testing.T, stub *mockstub.Stub, cn string, attrs map[string]string) {
+	t.Helper()
+	if err := stub.SetIdentity(testMSP, cn, attrs); err != nil {
+		t.Fatalf("set identity error: %v", err)
+	}
+}
+
+// invoke invokes function with args, and returns the payload of success
+// response
+func invoke(t *testing.T, stub *mockstub.Stub, function string, args ...string) []byte {
+	t.Helper()
+	resp := stub.MockInvoke(function, invokeArgs(function, args))
+	if resp.Status != shim.OK {
+		t.Fatalf("%s %v error: %s", function, args, resp.Message)
+	}
+	return resp.Payload
+}
+
+// invokeError invokes function with args, and fails the test if it doesn't
+// fail with error code
+func invokeError(t *testing.T, stub *mockstub.Stub, code, function string, args ...string) {
+	t.Helper()
+	resp := stub.MockInvoke(function, invokeArgs(function, args))
+	if resp.Status == shim.OK {
+		t.Fatalf("%s %v succeeded, want error %s", function, args, code)
+	}
+	env := ErrorEnvelope{}
+	if err := json.Unmarshal([]byte(resp.Message), &env); err != nil || env.Code != code {
+		t.Fatalf("%s %v: got error %s, want %s", function, args, resp.Message, code)
+	}
+}
+
+func invokeArgs(function string, args []string) [][]byte {
+	bs := [][]byte{[]byte(function)}
+	for _, a := range args {
+		bs = append(bs, []byte(a))
+	}
+	return bs
+}
+
+func TestHistory(t *testing.T) {
+	stub := newStub(t)
+	invoke(t, stub, "invoke", "a", "b", "10")
+	invoke(t, stub, "delete", "a")
+
+	var entries []HistoryEntry
+	if err := json.Unmarshal(invoke(t, stub, "history", "a"), &entries); err != nil {
+		t.Fatalf("unmarshal history error: %v", err)
+	}
+	// transactions of the stub are named by function
+	txIDs := []string{"init", "invoke", "delete"}
+	balances := []int{100, 90}
+	if len(entries) != len(txIDs) {
+		t.Fatalf("got history %+v, want %d entries", entries, len(txIDs))
+	}
+	for i, e := range entries {
+		if e.TxID != txIDs[i] || e.IsDelete != (i == 2) || e.Timestamp.IsZero() {
+			t.Fatalf("got history entry %d %+v, want tx %s", i, e, txIDs[i])
+		}
+		if e.IsDelete {
+			if e.Value != "" {
+				t.Fatalf("got value %s of deletion", e.Value)
+			}
+			continue
+		}
+		a := Account{}
+		if err := json.Unmarshal([]byte(e.Value), &a); err != nil {
+			t.Fatalf("unmarshal account error: %v", err)
+		}
+		if a.Balance != balances[i] || !a.Updated.Equal(e.Timestamp) {
+			t.Fatalf("got account %+v at %v, want balance %d", a, e.Timestamp, balances[i])
+		}
+	}
+
+	// keys without history have empty history
+	if payload := invoke(t, stub, "history", "c"); string(payload) != "[]" {
+		t.Fatalf("got history %s of c, want []", payload)
+	}
+	invokeError(t, stub, ErrCodeInvalidArgument, "history")
+	invokeError(t, stub, ErrCodeInvalidArgument, "history", "a", "b")
+}
+
+// call is an invocation of function with args, code is the error code
+// wanted, empty for success
+type call struct {
+	function string
+	args     []string
+	code     string
+}
+
+func TestAmountRules(t *testing.T) {
+	max := strconv.Itoa(maxInt)
+	tests := []struct {
+		name  string
+		init  []string
+		calls []call
+	}{
+		{"negative amount", nil, []call{
+			{"invoke", []string{"a", "b", "-1"}, ErrCodeInvalidAmount},
+			{"create", []string{"c", "-1"}, ErrCodeInvalidAmount},
+		}},
+		{"not integer", nil, []call{
+			{"invoke", []string{"a", "b", "1.5"}, ErrCodeInvalidAmount},
+			{"invoke", []string{"a", "b", max + "0"}, ErrCodeInvalidAmount},
+		}},
+		{"above default max amount", []string{"a", strconv.Itoa(DefaultMaxAmount + 1), "b", "0"}, []call{
+			{"invoke", []string{"a", "b", strconv.Itoa(DefaultMaxAmount + 1)}, ErrCodeAmountTooLarge},
+			{"invoke", []string{"a", "b", strconv.Itoa(DefaultMaxAmount)}, ""},
+		}},
+		{"above max amount of init", []string{"a", "100", "b", "200", "0", "10"}, []call{
+			{"invoke", []string{"a", "b", "11"}, ErrCodeAmountTooLarge},
+			{"invoke", []string{"a", "b", "10"}, ""},
+		}},
+		{"insufficient funds", nil, []call{
+			{"invoke", []string{"a", "b", "101"}, ErrCodeInsufficientFunds},
+			{"invoke", []string{"a", "b", "100"}, ""},
+			{"invoke", []string{"a", "b", "1"}, ErrCodeInsufficientFunds},
+		}},
+		{"overdraft limit of init", []string{"a", "100", "b", "200", "50"}, []call{
+			{"invoke", []string{"a", "b", "151"}, ErrCodeInsufficientFunds},
+			{"invoke", []string{"a", "b", "150"}, ""},
+			{"invoke", []string{"a", "b", "1"}, ErrCodeInsufficientFunds},
+			{"invoke", []string{"b", "a", "1"}, ""},
+			{"invoke", []string{"a", "b", "1"}, ""},
+		}},
+		{"balance overflow", []string{"a", "100", "b", max}, []call{
+			{"invoke", []string{"a", "b", "1"}, ErrCodeAmountTooLarge},
+			{"invoke", []string{"b", "a", "1"}, ""},
+			{"invoke", []string{"a", "b", "1"}, ""},
+			{"create", []string{"c", max}, ""},
+			{"invoke", []string{"c", "b", "1"}, ErrCodeAmountTooLarge},
+		}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			stub := newStub(t, test.init...)
+			for _, c := range test.calls {
+				if c.code == "" {
+					invoke(t, stub, c.function, c.args...)
+				} else {
+					invokeError(t, stub, c.code, c.function, c.args...)
+				}
+			}
+		})
+	}
+}
+
+func TestInitAmountRules(t *testing.T) {
+	max := strconv.Itoa(maxInt)
+	tests := []struct {
+		init []string
+		code string
+	}{
+		{[]string{"a", "-1", "b", "200"}, ErrCodeInvalidAmount},
+		{[]string{"a", "100", "b", max + "0"}, ErrCodeInvalidAmount},
+		{[]string{"a", "100", "b", "200", "-1"}, ErrCodeInvalidAmount},
+		{[]string{"a", "100", "b", "200", "0", "x"}, ErrCodeInvalidAmount},
+		{[]string{"a", "100", "b", "200", "0", "10", "1"}, ErrCodeInvalidArgument},
+	}
+	for _, test := range tests {
+		stub := mockstub.New("ex02", new(SimpleChaincode))
+		setIdentity(t, stub, "user1", nil)
+		resp := stub.MockInit("init", invokeArgs("init", test.init))
+		env := ErrorEnvelope{}
+		if err := json.Unmarshal([]byte(resp.Message), &env); err != nil || env.Code != test.code {
+			t.Fatalf("init %v: got %d %s, want error %s", test.init, resp.Status, resp.Message, test.code)
+		}
+	}
+}
+
+func TestDeleteNotFound(t *testing.T) {
+	stub := newStub(t)
+	invokeError(t, stub, ErrCodeNotFound, "delete", "c")
+	if events := stub.Events(); len(events) != 0 {
+		t.Fatalf("got events %v of failed delete", events)
+	}
+}
+
+func TestAuthorizeOwner(t *testing.T) {
+	stub := newStub(t)
+	setIdentity(t, stub, "user2", nil)
+	invoke(t, stub, "create", "c", "50")
+
+	// accounts of Init are owned by the msp, c is owned by user2 only
+	setIdentity(t, stub, "user1", nil)
+	invoke(t, stub, "invoke", "a", "b", "10")
+	invokeError(t, stub, ErrCodeUnauthorized, "invoke", "c", "a", "10")
+	invokeError(t, stub, ErrCodeUnauthorized, "delete", "c")
+
+	setIdentity(t, stub, "admin", map[string]string{AdminAttribute: AdminRole})
+	invoke(t, stub, "invoke", "c", "a", "10")
+	invoke(t, stub, "delete", "c")
+}
+
+func TestAuthorizeWithoutOwner(t *testing.T) {
+	stub := newStub(t)
+	key, err := accountKey(stub, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.MockTransactionStart("put")
+	err = stub.PutState(key, []byte(`{"docType":"account","name":"c","balance":50}`))
+	stub.MockTransactionEnd("put")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invokeError(t, stub, ErrCodeUnauthorized, "invoke", "c", "a", "10")
+	invokeError(t, stub, ErrCodeUnauthorized, "delete", "c")
+
+	setIdentity(t, stub, "admin", map[string]string{AdminAttribute: AdminRole})
+	invoke(t, stub, "delete", "c")
+}
+
+// newAccountsStub creates stub with accounts a(100) and b(200) of Init,
+// c(50) and d(150) of user2, and e(300) of user3
+func newAccountsStub(t *testing.T) *mockstub.Stub {
+	stub := newStub(t)
+	setIdentity(t, stub, "user2", nil)
+	invoke(t, stub, "create", "c", "50")
+	invoke(t, stub, "create", "d", "150", `{"tier":"gold"}`)
+	setIdentity(t, stub, "user3", nil)
+	invoke(t, stub, "create", "e", "300")
+	return stub
+}
+
+// pages invokes function with args, page size and bookmark until the last
+// page, and returns the names of accounts of each page
+func pages(t *testing.T, stub *mockstub.Stub, pageSize string, function string, args ...string) [][]string {
+	t.Helper()
+	var names [][]string
+	bookmark := ""
+	for {
+		payload := invoke(t, stub, function, append(args, pageSize, bookmark)...)
+		page := AccountPage{}
+		if err := json.Unmarshal(payload, &page); err != nil {
+			t.Fatalf("unmarshal page error: %v", err)
+		}
+		var pageNames []string
+		for _, a := range page.Accounts {
+			pageNames = append(pageNames, a.Name)
+		}
+		names = append(names, pageNames)
+		if page.Bookmark == "" {
+			return names
+		}
+		if len(names) > 10 {
+			t.Fatalf("too many pages %v", names)
+		}
+		bookmark = page.Bookmark
+	}
+}
+
+func assertPages(t *testing.T, got [][]string, want ...[]string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got pages %v, want %v", got, want)
+	}
+}
+
+func TestList(t *testing.T) {
+	stub := newAccountsStub(t)
+	assertPages(t, pages(t, stub, "2", "list"), []string{"a", "b"}, []string{"c", "d"}, []string{"e"})
+	assertPages(t, pages(t, stub, "5", "list"), []string{"a", "b", "c", "d", "e"})
+
+	payload := invoke(t, stub, "list", "1", "")
+	page := AccountPage{}
+	if err := json.Unmarshal(payload, &page); err != nil {
+		t.Fatal(err)
+	}
+	a := page.Accounts[0]
+	if a.DocType != AccountObjectType || a.Balance != 100 || a.Owner != (Owner{MSPID: testMSP}) {
+		t.Fatalf("got account %+v", a)
+	}
+
+	invokeError(t, stub, ErrCodeInvalidArgument, "list", "0", "")
+}
+
+// assertIndexes checks that the rich queries of stub use the wanted
+// indexes, and that all fields of the index are in the selector, as
+// CouchDB json indexes don't have the documents without any of them
+func assertIndexes(t *testing.T, stub *mockstub.Stub, want ...string) {
+	t.Helper()
+	var indexes []string
+	for _, query := range stub.Queries() {
+		q := richQuery{}
+		if err := json.Unmarshal([]byte(query), &q); err != nil {
+			t.Fatalf("unmarshal query error: %v", err)
+		}
+		if len(q.UseIndex) != 2 {
+			t.Fatalf("query %s doesn't use index", query)
+		}
+		name := q.UseIndex[1]
+		indexes = append(indexes, name)
+
+		b, err := ioutil.ReadFile(filepath.Join("META-INF", "statedb", "couchdb", "indexes", name+".json"))
+		if err != nil {
+			t.Fatalf("read index error: %v", err)
+		}
+		index := struct {
+			Index struct {
+				Fields []string `json:"fields"`
+			} `json:"index"`
+			DDoc string `json:"ddoc"`
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal(b, &index); err != nil {
+			t.Fatalf("unmarshal index error: %v", err)
+		}
+		if "_design/"+index.DDoc != q.UseIndex[0] || index.Name != name {
+			t.Fatalf("query uses %v, index is %s of %s", q.UseIndex, index.Name, index.DDoc)
+		}
+		for _, f := range index.Index.Fields {
+			if _, ok := q.Selector[f]; !ok {
+				t.Fatalf("field %s of index %s is not in selector of %s", f, name, query)
+			}
+		}
+	}
+	if !reflect.DeepEqual(indexes, want) {
+		t.Fatalf("queries use indexes %v, want %v", indexes, want)
+	}
+}
+
+func TestQueryByOwner(t *testing.T) {
+	stub := newAccountsStub(t)
+	assertPages(t, pages(t, stub, "2", "queryByOwner", testMSP, "CN=user2"), []string{"c", "d"})
+	assertPages(t, pages(t, stub, "1", "queryByOwner", testMSP, "CN=user2"), []string{"c"}, []string{"d"})
+	assertIndexes(t, stub, "indexOwner", "indexOwner", "indexOwner")
+
+	// accounts of Init have no subject, they are found without subject
+	assertPages(t, pages(t, stub, "2", "queryByOwner", testMSP, ""),
+		[]string{"a", "b"}, []string{"c", "d"}, []string{"e"})
+	assertPages(t, pages(t, stub, "2", "queryByOwner", "Org2MSP", ""), nil)
+	assertIndexes(t, stub, "indexOwnerMsp", "indexOwnerMsp", "indexOwnerMsp", "indexOwnerMsp")
+}
+
+func TestQueryRange(t *testing.T) {
+	stub := newAccountsStub(t)
+	// ordered by balance, c(50) a(100) d(150) b(200)
+	assertPages(t, pages(t, stub, "2", "queryRange", "50", "200"), []string{"c", "a"}, []string{"d", "b"})
+	assertPages(t, pages(t, stub, "3", "queryRange", "50", "200"), []string{"c", "a", "d"}, []string{"b"})
+	assertPages(t, pages(t, stub, "10", "queryRange", "101", "300"), []string{"d", "b", "e"})
+	assertPages(t, pages(t, stub, "10", "queryRange", "400", "500"), nil)
+	assertIndexes(t, stub, "indexBalance", "indexBalance", "indexBalance", "indexBalance",
+		"indexBalance", "indexBalance")
+
+	invokeError(t, stub, ErrCodeInvalidArgument, "queryRange", "x", "200", "2", "")
+}
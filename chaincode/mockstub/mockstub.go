@@ -0,0 +1,554 @@
+// Package mockstub wraps shim.MockStub of fabric 1.4 for unit tests of
+// chaincode_example02. It adds what the chaincode uses but MockStub doesn't
+// implement: the creator identity for cid, paginated range queries,
+// CouchDB rich queries and the history of keys.
+//
+// Rich queries support the selector of CouchDB with fields (dotted fields
+// for nested documents), implicit equality and the operators $eq, $ne,
+// $gt, $gte, $lt, $lte, $exists, $in, $and and $or. Results are ordered
+// by sort, fields asc or desc, or by key without sort. use_index is
+// ignored, Queries returns the queries for tests to check it.
+package mockstub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/common/attrmgr"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// Stub is a MockStub, MockInit and MockInvoke of it must be used, so the
+// chaincode is called with Stub instead of the embedded MockStub.
+type Stub struct {
+	*shim.MockStub
+
+	cc      shim.Chaincode
+	args    [][]byte
+	creator []byte
+	history map[string][]*queryresult.KeyModification
+	queries []string
+}
+
+// New creates stub of chaincode cc
+func New(name string, cc shim.Chaincode) *Stub {
+	return &Stub{
+		MockStub: shim.NewMockStub(name, cc),
+		cc:       cc,
+		history:  map[string][]*queryresult.KeyModification{},
+	}
+}
+
+// MockInit calls Init of chaincode in transaction txID
+func (s *Stub) MockInit(txID string, args [][]byte) pb.Response {
+	s.args = args
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	return s.cc.Init(s)
+}
+
+// MockInvoke calls Invoke of chaincode in transaction txID
+func (s *Stub) MockInvoke(txID string, args [][]byte) pb.Response {
+	s.args = args
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	return s.cc.Invoke(s)
+}
+
+// Events returns the events set by transactions since last call, only the
+// first 100 events are kept by MockStub
+func (s *Stub) Events() []*pb.ChaincodeEvent {
+	var events []*pb.ChaincodeEvent
+	for {
+		select {
+		case e := <-s.ChaincodeEventsChannel:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+// Queries returns the rich queries run since last call
+func (s *Stub) Queries() []string {
+	queries := s.queries
+	s.queries = nil
+	return queries
+}
+
+// GetArgs returns the args of current transaction
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs returns the args of current transaction as strings
+func (s *Stub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, a := range s.args {
+		args = append(args, string(a))
+	}
+	return args
+}
+
+// GetFunctionAndParameters returns the first arg as function
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// SetCreator sets the creator of transactions, certPEM is the pem encoded
+// certificate of the creator
+func (s *Stub) SetCreator(mspID string, certPEM []byte) error {
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: certPEM})
+	if err != nil {
+		return errors.WithMessage(err, "marshal creator error")
+	}
+	s.creator = creator
+	return nil
+}
+
+// SetIdentity sets creator to a self signed certificate of common name cn,
+// attrs are the attributes of fabric-ca read by cid, e.g. the admin role
+func (s *Stub) SetIdentity(mspID, cn string, attrs map[string]string) error {
+	certPEM, err := NewCert(cn, attrs)
+	if err != nil {
+		return err
+	}
+	return s.SetCreator(mspID, certPEM)
+}
+
+// GetCreator returns the creator set by SetCreator
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+// PutState writes the state of key, and adds it to the history of key
+func (s *Stub) PutState(key string, value []byte) error {
+	if err := s.MockStub.PutState(key, value); err != nil {
+		return err
+	}
+	s.addHistory(key, value, false)
+	return nil
+}
+
+// DelState deletes the state of key, and adds the deletion to the history
+// of key
+func (s *Stub) DelState(key string) error {
+	if err := s.MockStub.DelState(key); err != nil {
+		return err
+	}
+	s.addHistory(key, nil, true)
+	return nil
+}
+
+func (s *Stub) addHistory(key string, value []byte, isDelete bool) {
+	s.history[key] = append(s.history[key], &queryresult.KeyModification{
+		TxId:      s.TxID,
+		Value:     value,
+		Timestamp: s.TxTimestamp,
+		IsDelete:  isDelete,
+	})
+}
+
+// GetHistoryForKey returns the modifications of key from the oldest, as
+// fabric 1.4 does
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{mods: s.history[key]}, nil
+}
+
+// NewCert creates pem encoded self signed certificate of common name cn
+// with fabric-ca attributes
+func NewCert(cn string, attrs map[string]string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.WithMessage(err, "generate key error")
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if len(attrs) > 0 {
+		err := attrmgr.New().AddAttributesToCert(&attrmgr.Attributes{Attrs: attrs}, tmpl)
+		if err != nil {
+			return nil, errors.WithMessage(err, "add attributes error")
+		}
+		// CreateCertificate writes ExtraExtensions only
+		tmpl.ExtraExtensions, tmpl.Extensions = tmpl.Extensions, nil
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "create certificate error")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// GetStateByRangeWithPagination returns a page of keys in [startKey,
+// endKey), the bookmark is the first key of next page
+func (s *Stub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	return s.page(startKey, endKey, pageSize, bookmark)
+}
+
+// GetStateByPartialCompositeKeyWithPagination is
+// GetStateByRangeWithPagination of the keys prefixed by the partial
+// composite key
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string,
+	pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.page(prefix, prefix+string(utf8.MaxRune), pageSize, bookmark)
+}
+
+// GetQueryResult returns the json documents selected by the rich query
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	iter, _, err := s.GetQueryResultWithPagination(query, 0, "")
+	return iter, err
+}
+
+// GetQueryResultWithPagination returns a page of the json documents
+// selected by the rich query, pageSize 0 means all
+func (s *Stub) GetQueryResultWithPagination(query string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	s.queries = append(s.queries, query)
+	q := struct {
+		Selector map[string]interface{} `json:"selector"`
+		Sort     []interface{}          `json:"sort"`
+	}{}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, nil, errors.WithMessage(err, "invalid query")
+	}
+	if q.Selector == nil {
+		return nil, nil, errors.New("invalid query, selector is required")
+	}
+	fields, err := sortFields(q.Sort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var kvs []*queryresult.KV
+	docs := map[string]map[string]interface{}{}
+	for _, k := range s.keys("", "") {
+		doc := map[string]interface{}{}
+		if err := json.Unmarshal(s.State[k], &doc); err != nil || !matchSelector(doc, q.Selector) {
+			continue
+		}
+		kvs = append(kvs, &queryresult.KV{Namespace: s.Name, Key: k, Value: s.State[k]})
+		docs[k] = doc
+	}
+	sort.SliceStable(kvs, func(i, j int) bool {
+		return lessDoc(docs[kvs[i].Key], docs[kvs[j].Key], fields)
+	})
+
+	// the bookmark is the key of the first doc of the page in sort order
+	start := 0
+	if bookmark != "" {
+		start = len(kvs)
+		for i, kv := range kvs {
+			if kv.Key == bookmark {
+				start = i
+				break
+			}
+		}
+	}
+	kvs = kvs[start:]
+
+	meta := &pb.QueryResponseMetadata{}
+	if pageSize > 0 && len(kvs) > int(pageSize) {
+		meta.Bookmark = kvs[pageSize].Key
+		kvs = kvs[:pageSize]
+	}
+	meta.FetchedRecordsCount = int32(len(kvs))
+	return &iterator{kvs: kvs}, meta, nil
+}
+
+// sortField is a field of sort, desc is false for asc
+type sortField struct {
+	name string
+	desc bool
+}
+
+// sortFields parses sort of query, a field is "field" or {"field": "asc"}
+// or {"field": "desc"}
+func sortFields(spec []interface{}) ([]sortField, error) {
+	var fields []sortField
+	for _, f := range spec {
+		switch v := f.(type) {
+		case string:
+			fields = append(fields, sortField{name: v})
+		case map[string]interface{}:
+			for name, dir := range v {
+				if dir != "asc" && dir != "desc" {
+					return nil, errors.Errorf("invalid query, invalid sort direction %v of %s", dir, name)
+				}
+				fields = append(fields, sortField{name: name, desc: dir == "desc"})
+			}
+		default:
+			return nil, errors.Errorf("invalid query, invalid sort %v", f)
+		}
+	}
+	return fields, nil
+}
+
+// lessDoc reports whether doc a is before b by sort fields, missing field
+// is before others, values not ordered are equal
+func lessDoc(a, b map[string]interface{}, fields []sortField) bool {
+	for _, f := range fields {
+		va, foundA := lookup(a, f.name)
+		vb, foundB := lookup(b, f.name)
+
+		c := 0
+		switch {
+		case !foundA && foundB:
+			c = -1
+		case foundA && !foundB:
+			c = 1
+		case foundA && foundB && ordered(va, vb):
+			c = compare(va, vb)
+		}
+		if f.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+// page returns at most pageSize keys in [startKey, endKey) from bookmark,
+// empty endKey means no end
+func (s *Stub) page(startKey, endKey string, pageSize int32,
+	bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if bookmark > startKey {
+		startKey = bookmark
+	}
+
+	iter := &iterator{}
+	meta := &pb.QueryResponseMetadata{}
+	for _, k := range s.keys(startKey, endKey) {
+		if pageSize > 0 && int32(len(iter.kvs)) == pageSize {
+			meta.Bookmark = k
+			break
+		}
+		iter.kvs = append(iter.kvs, &queryresult.KV{Namespace: s.Name, Key: k, Value: s.State[k]})
+	}
+	meta.FetchedRecordsCount = int32(len(iter.kvs))
+	return iter, meta, nil
+}
+
+// keys returns the sorted keys in [startKey, endKey), empty endKey means
+// no end
+func (s *Stub) keys(startKey, endKey string) []string {
+	keys := make([]string, 0, len(s.State))
+	for k := range s.State {
+		if k >= startKey && (endKey == "" || k < endKey) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// iterator iterates the kvs of a page
+type iterator struct {
+	kvs []*queryresult.KV
+}
+
+func (it *iterator) HasNext() bool {
+	return len(it.kvs) > 0
+}
+
+func (it *iterator) Next() (*queryresult.KV, error) {
+	if len(it.kvs) == 0 {
+		return nil, errors.New("no more results")
+	}
+	kv := it.kvs[0]
+	it.kvs = it.kvs[1:]
+	return kv, nil
+}
+
+func (it *iterator) Close() error {
+	it.kvs = nil
+	return nil
+}
+
+// historyIterator iterates the modifications of a key
+type historyIterator struct {
+	mods []*queryresult.KeyModification
+}
+
+func (it *historyIterator) HasNext() bool {
+	return len(it.mods) > 0
+}
+
+func (it *historyIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.mods) == 0 {
+		return nil, errors.New("no more results")
+	}
+	m := it.mods[0]
+	it.mods = it.mods[1:]
+	return m, nil
+}
+
+func (it *historyIterator) Close() error {
+	it.mods = nil
+	return nil
+}
+
+// matchSelector reports whether doc matches all conditions of selector
+func matchSelector(doc map[string]interface{}, selector map[string]interface{}) bool {
+	for field, cond := range selector {
+		switch field {
+		case "$and", "$or":
+			subs, ok := cond.([]interface{})
+			if !ok {
+				return false
+			}
+			matched := 0
+			for _, sub := range subs {
+				if m, ok := sub.(map[string]interface{}); ok && matchSelector(doc, m) {
+					matched++
+				}
+			}
+			if field == "$and" && matched != len(subs) || field == "$or" && matched == 0 {
+				return false
+			}
+		default:
+			v, found := lookup(doc, field)
+			if !matchCondition(v, found, cond) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lookup returns the value of dotted field in doc
+func lookup(doc map[string]interface{}, field string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, name := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// matchCondition matches value v of field with condition, the condition is
+// an object of operators, a nested selector, or a value for equality
+func matchCondition(v interface{}, found bool, cond interface{}) bool {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		return found && compare(v, cond) == 0
+	}
+	if !isOperators(ops) {
+		sub, ok := v.(map[string]interface{})
+		return found && ok && matchSelector(sub, ops)
+	}
+
+	for op, arg := range ops {
+		var matched bool
+		switch op {
+		case "$exists":
+			matched = arg == found
+		case "$eq":
+			matched = found && compare(v, arg) == 0
+		case "$ne":
+			matched = !found || compare(v, arg) != 0
+		case "$gt":
+			matched = found && compare(v, arg) > 0 && ordered(v, arg)
+		case "$gte":
+			matched = found && compare(v, arg) >= 0 && ordered(v, arg)
+		case "$lt":
+			matched = found && compare(v, arg) < 0 && ordered(v, arg)
+		case "$lte":
+			matched = found && compare(v, arg) <= 0 && ordered(v, arg)
+		case "$in":
+			list, _ := arg.([]interface{})
+			for _, a := range list {
+				if found && compare(v, a) == 0 {
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func isOperators(m map[string]interface{}) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
+
+func ordered(a, b interface{}) bool {
+	switch a.(type) {
+	case float64:
+		_, ok := b.(float64)
+		return ok
+	case string:
+		_, ok := b.(string)
+		return ok
+	}
+	return false
+}
+
+// compare compares json values, numbers and strings are ordered, other
+// values are compared by their json, non zero if they are different
+func compare(a, b interface{}) int {
+	switch x := a.(type) {
+	case float64:
+		if y, ok := b.(float64); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if string(ja) == string(jb) {
+		return 0
+	}
+	return -2
+}
@@ -0,0 +1,138 @@
+// Package types mirrors the types of chaincode_example02 that are visible
+// to clients, e.g. event payloads. The chaincode is a single file copied
+// into fabric-samples, so it can't import this package, keep them same.
+package types
+
+import (
+	"strings"
+	"time"
+)
+
+// Event names of chaincode_example02. They replace InvokeEvent and
+// DeleteEvent, whose payload was the raw args, listeners of the old names
+// no longer receive events. A transaction keeps only its last event, so
+// the old names can't be emitted alongside.
+const (
+	TransferEvent = "Transfer"
+	DeletedEvent  = "Deleted"
+)
+
+// Transfer is the payload of TransferEvent, Balances is the balances of
+// From and To after transfer
+type Transfer struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Amount   int            `json:"amount"`
+	Balances map[string]int `json:"balances"`
+}
+
+// Deleted is the payload of DeletedEvent
+type Deleted struct {
+	Key string `json:"key"`
+}
+
+// HistoryEntry is a value of key in history, Value is empty if the key was
+// deleted by the transaction
+type HistoryEntry struct {
+	TxID      string    `json:"txId"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDelete  bool      `json:"isDelete"`
+}
+
+// Accounts are stored as json Account under composite keys of
+// AccountObjectType, DocType of Account is AccountObjectType, so rich
+// queries can select accounts by it.
+const AccountObjectType = "account"
+
+// Account is the state of account, Updated is the time of the last
+// transaction that writes it
+type Account struct {
+	DocType  string            `json:"docType"`
+	Name     string            `json:"name"`
+	Balance  int               `json:"balance"`
+	Owner    Owner             `json:"owner"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Updated  time.Time         `json:"updated"`
+}
+
+// Callers with attribute AdminAttribute of value AdminRole can debit and
+// delete any account
+const (
+	AdminAttribute = "role"
+	AdminRole      = "admin"
+)
+
+// Owner is the owner of account, only the owner can debit or delete the
+// account. Empty Subject means any member of MSPID, e.g. the accounts of
+// Init. Empty MSPID means no owner, only admins can debit or delete it.
+type Owner struct {
+	MSPID   string `json:"mspId"`
+	Subject string `json:"subject,omitempty"`
+}
+
+// AccountPage is a page of accounts, Bookmark is used to query the next
+// page, it's empty if there is no more accounts
+type AccountPage struct {
+	Accounts []Account `json:"accounts"`
+	Bookmark string    `json:"bookmark"`
+}
+
+// compositeKeyNamespace is the leading byte and separator of composite keys,
+// same as shim.CreateCompositeKey
+const compositeKeyNamespace = "\x00"
+
+// CompositeKey returns the composite key of objectType and attributes as
+// shim.CreateCompositeKey does, e.g. the state key of account
+func CompositeKey(objectType string, attributes ...string) string {
+	key := compositeKeyNamespace + objectType + compositeKeyNamespace
+	for _, attr := range attributes {
+		key += attr + compositeKeyNamespace
+	}
+	return key
+}
+
+// SplitCompositeKey splits composite key into object type and attributes,
+// false if key is not a composite key
+func SplitCompositeKey(key string) (string, []string, bool) {
+	if !strings.HasPrefix(key, compositeKeyNamespace) || !strings.HasSuffix(key, compositeKeyNamespace) || len(key) < 2 {
+		return "", nil, false
+	}
+	parts := strings.Split(key[1:len(key)-1], compositeKeyNamespace)
+	return parts[0], parts[1:], true
+}
+
+// Error codes of failed responses, the message of response is json
+// ErrorEnvelope
+const (
+	ErrCodeInternal          = "INTERNAL"
+	ErrCodeUnknownFunction   = "UNKNOWN_FUNCTION"
+	ErrCodeInvalidArgument   = "INVALID_ARGUMENT"
+	ErrCodeInvalidAmount     = "INVALID_AMOUNT"
+	ErrCodeAmountTooLarge    = "AMOUNT_TOO_LARGE"
+	ErrCodeInsufficientFunds = "INSUFFICIENT_FUNDS"
+	ErrCodeNotFound          = "NOT_FOUND"
+	ErrCodeUnauthorized      = "UNAUTHORIZED"
+)
+
+// ErrorEnvelope is the message of all failed responses, Details has the
+// values related to the error, e.g. the balance of INSUFFICIENT_FUNDS
+type ErrorEnvelope struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Config is the limits of transfer configured at Init, balance can be
+// negative down to -OverdraftLimit, and the amount of a transfer can't be
+// greater than MaxAmount
+type Config struct {
+	OverdraftLimit int `json:"overdraftLimit"`
+	MaxAmount      int `json:"maxAmount"`
+}
+
+// ConfigObjectType is the composite key of Config
+const ConfigObjectType = "config"
+
+// DefaultMaxAmount is the MaxAmount if Init doesn't set it
+const DefaultMaxAmount = 1000000
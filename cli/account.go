@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+	"github.com/shitaibin/fabric-sdk-go-sample/chaincode/types"
+)
+
+// CreateAccount creates account name with initial balance and optional
+// metadata, the user of client is the owner
+func (c *Client) CreateAccount(peers []string, name string, balance int, metadata map[string]string, opts ...InvokeOption) (fab.TransactionID, error) {
+	log.Printf("Invoke create %s", name)
+	args := []string{name, strconv.Itoa(balance)}
+	if len(metadata) > 0 {
+		md, err := json.Marshal(metadata)
+		if err != nil {
+			return "", errors.WithMessage(err, "marshal metadata error")
+		}
+		args = append(args, string(md))
+	}
+	req := channel.Request{
+		ChaincodeID: c.CCID,
+		Fcn:         "create",
+		Args:        packArgs(args),
+	}
+	if err := applyInvokeOptions(&req, opts); err != nil {
+		return "", err
+	}
+
+	reqPeers := channel.WithTargetEndpoints(peers...)
+	return c.executeInvoke(req, reqPeers)
+}
+
+// ListAccounts returns a page of accounts ordered by name, bookmark is
+// empty for the first page, and the Bookmark of the returned page is used
+// for the next page
+func (c *Client) ListAccounts(peer string, pageSize int, bookmark string) (*types.AccountPage, error) {
+	return c.queryAccounts(peer, "list", strconv.Itoa(pageSize), bookmark)
+}
+
+// QueryAccountsByOwner returns a page of accounts owned by mspID, empty
+// subject matches all owners of the msp. It's a rich query, the peer
+// should use CouchDB.
+func (c *Client) QueryAccountsByOwner(peer, mspID, subject string, pageSize int, bookmark string) (*types.AccountPage, error) {
+	return c.queryAccounts(peer, "queryByOwner", mspID, subject, strconv.Itoa(pageSize), bookmark)
+}
+
+// QueryAccountsByBalance returns a page of accounts whose balance is in
+// [min, max] ordered by balance. It's a rich query, the peer should use
+// CouchDB.
+func (c *Client) QueryAccountsByBalance(peer string, min, max, pageSize int, bookmark string) (*types.AccountPage, error) {
+	return c.queryAccounts(peer, "queryRange", strconv.Itoa(min), strconv.Itoa(max), strconv.Itoa(pageSize), bookmark)
+}
+
+func (c *Client) queryAccounts(peer, fcn string, args ...string) (*types.AccountPage, error) {
+	req := channel.Request{
+		ChaincodeID: c.CCID,
+		Fcn:         fcn,
+		Args:        packArgs(args),
+	}
+
+	reqPeers := channel.WithTargetEndpoints(peer)
+	resp, err := c.cc.Query(req, reqPeers)
+	if err != nil {
+		return nil, errors.WithMessagef(chaincodeError(err), "%s accounts error", fcn)
+	}
+
+	page := &types.AccountPage{}
+	if err := json.Unmarshal(resp.Payload, page); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal accounts error")
+	}
+	return page, nil
+}
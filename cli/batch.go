@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// Request is a single invoke of the batch
+type Request struct {
+	Fcn   string
+	Args  []string
+	Peers []string // endorsers, the selection service is used if empty
+	Opts  []InvokeOption
+}
+
+// TxState is the final state of a request in the batch
+type TxState int
+
+const (
+	// TxFailed means the tx was not endorsed or not submitted
+	TxFailed TxState = iota
+	// TxCommitted means the tx was committed as valid
+	TxCommitted
+	// TxInvalid means the tx was committed but marked invalid
+	TxInvalid
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxCommitted:
+		return "committed"
+	case TxInvalid:
+		return "invalid"
+	default:
+		return "failed"
+	}
+}
+
+// BatchResult is the result of a request in the batch
+type BatchResult struct {
+	Index          int // index of the request in the batch
+	TxID           fab.TransactionID
+	State          TxState
+	ValidationCode pb.TxValidationCode
+	Latency        time.Duration // from sending proposal to receiving commit event
+	Err            error
+}
+
+// BatchStats is the aggregate statistics of a batch
+type BatchStats struct {
+	Total     int
+	Committed int
+	Invalid   int
+	Failed    int
+	Duration  time.Duration // wall time of the whole batch
+
+	// Latency percentiles of the requests which reached the ledger
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// InvokeBatch invokes all reqs with at most concurrency requests in
+// flight. Each request is endorsed, submitted and tracked by its tx status
+// event independently, so one failure won't stop the others. The results
+// are in the same order as reqs.
+func (c *Client) InvokeBatch(reqs []Request, concurrency int) ([]BatchResult, BatchStats, error) {
+	if concurrency <= 0 {
+		return nil, BatchStats{}, errors.New("concurrency should be positive")
+	}
+
+	results := make([]BatchResult, len(reqs))
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = c.invokeOne(reqs[i])
+			results[i].Index = i
+		}(i)
+	}
+	wg.Wait()
+
+	return results, newBatchStats(results, time.Since(start)), nil
+}
+
+func (c *Client) invokeOne(r Request) BatchResult {
+	req := channel.Request{
+		ChaincodeID: c.CCID,
+		Fcn:         r.Fcn,
+		Args:        packArgs(r.Args),
+	}
+	if err := applyInvokeOptions(&req, r.Opts); err != nil {
+		return BatchResult{State: TxFailed, Err: err}
+	}
+
+	var opts []channel.RequestOption
+	if len(r.Peers) > 0 {
+		opts = append(opts, channel.WithTargetEndpoints(r.Peers...))
+	}
+
+	start := time.Now()
+	resp, err := c.cc.Execute(req, opts...)
+	res := BatchResult{
+		TxID:           resp.TransactionID,
+		ValidationCode: resp.TxValidationCode,
+		Latency:        time.Since(start),
+		Err:            err,
+	}
+
+	if err == nil {
+		res.State = TxCommitted
+		return res
+	}
+
+	// invalid tx is reported by the commit handler with event server status
+	if s, ok := status.FromError(err); ok && s.Group == status.EventServerStatus {
+		res.State = TxInvalid
+		res.ValidationCode = pb.TxValidationCode(s.Code)
+		return res
+	}
+	res.State = TxFailed
+	return res
+}
+
+func newBatchStats(results []BatchResult, d time.Duration) BatchStats {
+	stats := BatchStats{Total: len(results), Duration: d}
+
+	var latencies []time.Duration
+	for _, r := range results {
+		switch r.State {
+		case TxCommitted:
+			stats.Committed++
+		case TxInvalid:
+			stats.Invalid++
+		default:
+			stats.Failed++
+			continue
+		}
+		latencies = append(latencies, r.Latency)
+	}
+	if len(latencies) == 0 {
+		return stats
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.P50 = percentile(latencies, 50)
+	stats.P90 = percentile(latencies, 90)
+	stats.P99 = percentile(latencies, 99)
+	stats.Max = latencies[len(latencies)-1]
+	return stats
+}
+
+// percentile uses nearest-rank method, sorted should be ascending
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
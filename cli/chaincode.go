@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
 	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
 	"github.com/pkg/errors"
+	"github.com/shitaibin/fabric-sdk-go-sample/chaincode/types"
 )
 
 // InstallCC install chaincode for target peer
@@ -101,32 +103,55 @@ func (c *Client) genPolicy(p string) (*common.SignaturePolicyEnvelope, error) {
 	return cauthdsl.FromString(p)
 }
 
-func (c *Client) InvokeCC(peers []string) (fab.TransactionID, error) {
+// InvokeCC transfer 10 from a to b, opts can set transient data of
+// the request, transient values are never logged. If the endorsers
+// diverged, the cause of error is a *DivergenceError.
+func (c *Client) InvokeCC(peers []string, opts ...InvokeOption) (fab.TransactionID, error) {
+	req, err := c.newInvokeRequest(opts)
+	if err != nil {
+		return "", err
+	}
+
+	// peers is needed
+	reqPeers := channel.WithTargetEndpoints(peers...)
+	return c.executeInvoke(req, reqPeers)
+}
+
+func (c *Client) newInvokeRequest(opts []InvokeOption) (channel.Request, error) {
 	// new channel request for invoke
 	args := packArgs([]string{"a", "b", "10"})
 	req := channel.Request{
-		ChaincodeID: "mycc",
+		ChaincodeID: c.CCID,
 		Fcn:         "invoke",
 		Args:        args,
 	}
+	if err := applyInvokeOptions(&req, opts); err != nil {
+		return req, err
+	}
+	if len(req.TransientMap) > 0 {
+		log.Printf("Invoke with transient: %v", TransientMap(req.TransientMap))
+	}
+	return req, nil
+}
 
+func (c *Client) executeInvoke(req channel.Request, reqPeers channel.RequestOption) (fab.TransactionID, error) {
 	// send request and handle response
-	// peers is needed
-	reqPeers := channel.WithTargetEndpoints(peers...)
-	resp, err := c.cc.Execute(req, reqPeers)
+	// divergent endorsements are reported by DivergenceError, and errors
+	// of chaincode by the typed errors of ChaincodeError
+	resp, err := c.cc.InvokeHandler(newExecuteHandler(), req, reqPeers)
 	log.Printf("Invoke chaincode response:\n"+
 		"id: %v\nvalidate: %v\nchaincode status: %v\n\n",
 		resp.TransactionID,
 		resp.TxValidationCode,
 		resp.ChaincodeStatus)
 	if err != nil {
-		return "", errors.WithMessage(err, "invoke chaincode error")
+		return "", errors.WithMessage(chaincodeError(err), "invoke chaincode error")
 	}
 
 	return resp.TransactionID, nil
 }
 
-func (c *Client) InvokeCCDelete(peers []string) (fab.TransactionID, error) {
+func (c *Client) InvokeCCDelete(peers []string, opts ...InvokeOption) (fab.TransactionID, error) {
 	log.Println("Invoke delete")
 	// new channel request for invoke
 	args := packArgs([]string{"c"})
@@ -135,6 +160,9 @@ func (c *Client) InvokeCCDelete(peers []string) (fab.TransactionID, error) {
 		Fcn:         "delete",
 		Args:        args,
 	}
+	if err := applyInvokeOptions(&req, opts); err != nil {
+		return "", err
+	}
 
 	// send request and handle response
 	// peers is needed
@@ -146,7 +174,7 @@ func (c *Client) InvokeCCDelete(peers []string) (fab.TransactionID, error) {
 		resp.TxValidationCode,
 		resp.ChaincodeStatus)
 	if err != nil {
-		return "", errors.WithMessage(err, "invoke chaincode error")
+		return "", errors.WithMessage(chaincodeError(err), "invoke chaincode error")
 	}
 
 	return resp.TransactionID, nil
@@ -155,7 +183,7 @@ func (c *Client) InvokeCCDelete(peers []string) (fab.TransactionID, error) {
 func (c *Client) QueryCC(peer, keys string) error {
 	// new channel request for query
 	req := channel.Request{
-		ChaincodeID: "mycc",
+		ChaincodeID: c.CCID,
 		Fcn:         "query",
 		Args:        packArgs([]string{keys}),
 	}
@@ -164,7 +192,7 @@ func (c *Client) QueryCC(peer, keys string) error {
 	reqPeers := channel.WithTargetEndpoints(peer)
 	resp, err := c.cc.Query(req, reqPeers)
 	if err != nil {
-		return errors.WithMessage(err, "query chaincode error")
+		return errors.WithMessage(chaincodeError(err), "query chaincode error")
 	}
 
 	log.Printf("Query chaincode tx response:\ntx: %s\nresult: %v\n\n",
@@ -173,6 +201,27 @@ func (c *Client) QueryCC(peer, keys string) error {
 	return nil
 }
 
+// QueryHistory returns the values of key in history, oldest first
+func (c *Client) QueryHistory(peer, key string) ([]types.HistoryEntry, error) {
+	req := channel.Request{
+		ChaincodeID: c.CCID,
+		Fcn:         "history",
+		Args:        packArgs([]string{key}),
+	}
+
+	reqPeers := channel.WithTargetEndpoints(peer)
+	resp, err := c.cc.Query(req, reqPeers)
+	if err != nil {
+		return nil, errors.WithMessage(chaincodeError(err), "query history error")
+	}
+
+	var entries []types.HistoryEntry
+	if err := json.Unmarshal(resp.Payload, &entries); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal history error")
+	}
+	return entries, nil
+}
+
 func (c *Client) UpgradeCC(v string, peer string) error {
 	// endorser policy
 	org1AndOrg2 := "AND('Org1MSP.member','Org2MSP.member')"
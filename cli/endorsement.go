@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/shitaibin/fabric-sdk-go-sample/rwset"
+)
+
+// EndorsementReport describes how the responses of endorsers differ from
+// the response of the reference endorser, which is the first responder.
+type EndorsementReport struct {
+	Reference   string
+	Divergences []PeerDivergence
+}
+
+// Diverged reports whether any endorser diverged from the reference
+func (r *EndorsementReport) Diverged() bool {
+	return len(r.Divergences) > 0
+}
+
+func (r *EndorsementReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "reference endorser: %s", r.Reference)
+	for _, d := range r.Divergences {
+		fmt.Fprintf(&sb, "\n%s", d)
+	}
+	return sb.String()
+}
+
+// PeerDivergence is the difference between an endorser and the reference
+type PeerDivergence struct {
+	Endorser       string
+	StatusDiffers  bool // chaincode status
+	PayloadDiffers bool // chaincode response payload
+	Keys           []KeyDivergence
+	DecodeErr      error // read write set can't be decoded
+}
+
+func (d PeerDivergence) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "endorser %s diverged:", d.Endorser)
+	if d.StatusDiffers {
+		sb.WriteString(" status")
+	}
+	if d.PayloadDiffers {
+		sb.WriteString(" payload")
+	}
+	if d.DecodeErr != nil {
+		fmt.Fprintf(&sb, " decode error(%v)", d.DecodeErr)
+	}
+	for _, k := range d.Keys {
+		fmt.Fprintf(&sb, "\n  %s", k)
+	}
+	return sb.String()
+}
+
+// KeyDivergence is a key that read or written differently by an endorser
+type KeyDivergence struct {
+	Namespace string
+	Key       string
+	Kind      string // "read" or "write"
+	Reference string // how reference endorser saw the key, "" means absent
+	Actual    string // how this endorser saw the key, "" means absent
+}
+
+func (k KeyDivergence) String() string {
+	return fmt.Sprintf("%s %s/%s: reference=%q actual=%q",
+		k.Kind, k.Namespace, k.Key, k.Reference, k.Actual)
+}
+
+// DivergenceError is returned when endorsers produced different results,
+// use errors.Cause to get it from the error of invoke.
+type DivergenceError struct {
+	Report *EndorsementReport
+}
+
+func (e *DivergenceError) Error() string {
+	return "endorsement responses diverged, " + e.Report.String()
+}
+
+// CompareEndorsements diffs the status, payload and read write sets of
+// all responses against the first one
+func CompareEndorsements(resps []*fab.TransactionProposalResponse) *EndorsementReport {
+	report := &EndorsementReport{}
+	if len(resps) == 0 {
+		return report
+	}
+
+	ref := resps[0]
+	report.Reference = ref.Endorser
+	refSets, refErr := responseRWSets(ref)
+
+	for _, r := range resps[1:] {
+		d := PeerDivergence{
+			Endorser:       r.Endorser,
+			StatusDiffers:  r.ChaincodeStatus != ref.ChaincodeStatus,
+			PayloadDiffers: !bytes.Equal(r.GetResponse().GetPayload(), ref.GetResponse().GetPayload()),
+		}
+
+		if bytes.Equal(r.Payload, ref.Payload) {
+			if d.StatusDiffers || d.PayloadDiffers {
+				report.Divergences = append(report.Divergences, d)
+			}
+			continue
+		}
+
+		sets, err := responseRWSets(r)
+		switch {
+		case refErr != nil:
+			d.DecodeErr = refErr
+		case err != nil:
+			d.DecodeErr = err
+		default:
+			d.Keys = diffRWSets(refSets, sets)
+		}
+		report.Divergences = append(report.Divergences, d)
+	}
+	return report
+}
+
+func responseRWSets(r *fab.TransactionProposalResponse) ([]NsReadWriteSet, error) {
+	if r.ProposalResponse == nil {
+		return nil, fmt.Errorf("no proposal response from %s", r.Endorser)
+	}
+	ca, err := rwset.UnmarshalChaincodeAction(r.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return rwset.UnmarshalTxReadWriteSet(ca.Results)
+}
+
+func diffRWSets(ref, actual []NsReadWriteSet) []KeyDivergence {
+	refKV := flattenRWSets(ref)
+	actualKV := flattenRWSets(actual)
+
+	var keys []KeyDivergence
+	for _, e := range refKV.order {
+		if refKV.values[e] != actualKV.values[e] {
+			keys = append(keys, e.divergence(refKV.values[e], actualKV.values[e]))
+		}
+	}
+	for _, e := range actualKV.order {
+		if _, ok := refKV.values[e]; !ok {
+			keys = append(keys, e.divergence("", actualKV.values[e]))
+		}
+	}
+	return keys
+}
+
+type kvEntry struct {
+	namespace, key, kind string
+}
+
+func (e kvEntry) divergence(ref, actual string) KeyDivergence {
+	return KeyDivergence{
+		Namespace: e.namespace,
+		Key:       e.key,
+		Kind:      e.kind,
+		Reference: ref,
+		Actual:    actual,
+	}
+}
+
+type kvEntries struct {
+	order  []kvEntry
+	values map[kvEntry]string
+}
+
+// flattenRWSets describes every read and write as a string so they can be
+// compared directly
+func flattenRWSets(sets []NsReadWriteSet) kvEntries {
+	kv := kvEntries{values: make(map[kvEntry]string)}
+	add := func(e kvEntry, v string) {
+		kv.order = append(kv.order, e)
+		kv.values[e] = v
+	}
+
+	for _, ns := range sets {
+		for _, r := range ns.Reads {
+			v := "absent"
+			if r.Exists {
+				v = fmt.Sprintf("version %d:%d", r.BlockNum, r.TxNum)
+			}
+			add(kvEntry{ns.Namespace, r.Key, "read"}, v)
+		}
+		for _, w := range ns.Writes {
+			v := "delete"
+			if !w.IsDelete {
+				v = "value " + string(w.Value)
+			}
+			add(kvEntry{ns.Namespace, w.Key, "write"}, v)
+		}
+	}
+	return kv
+}
+
+// EndorsementCompareHandler compares all proposal responses before they are
+// validated, and fails the request with a DivergenceError if any endorser
+// diverged.
+type EndorsementCompareHandler struct {
+	next invoke.Handler
+}
+
+// NewEndorsementCompareHandler returns a handler that compares endorsements
+func NewEndorsementCompareHandler(next ...invoke.Handler) *EndorsementCompareHandler {
+	h := &EndorsementCompareHandler{}
+	if len(next) > 0 {
+		h.next = next[0]
+	}
+	return h
+}
+
+// Handle compares the responses of endorsers
+func (h *EndorsementCompareHandler) Handle(requestContext *invoke.RequestContext, clientContext *invoke.ClientContext) {
+	report := CompareEndorsements(requestContext.Response.Responses)
+	if report.Diverged() {
+		requestContext.Error = &DivergenceError{Report: report}
+		return
+	}
+
+	if h.next != nil {
+		h.next.Handle(requestContext, clientContext)
+	}
+}
+
+// newExecuteHandler is the execute handler of sdk with endorsement comparing
+func newExecuteHandler() invoke.Handler {
+	return invoke.NewSelectAndEndorseHandler(
+		NewEndorsementCompareHandler(
+			invoke.NewEndorsementValidationHandler(
+				invoke.NewSignatureValidationHandler(invoke.NewCommitHandler()),
+			),
+		),
+	)
+}
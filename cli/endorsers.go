@@ -0,0 +1,332 @@
+package cli
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/common/selection/fabricselection"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/comm"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mspproto "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// EndorserLayout is the number of endorsements needed from each msp
+type EndorserLayout map[string]int
+
+// Size is the total number of endorsements of the layout
+func (l EndorserLayout) Size() int {
+	n := 0
+	for _, c := range l {
+		n += c
+	}
+	return n
+}
+
+// EndorserSelector selects a minimal set of endorsers for chaincode: the
+// peers of the smallest layout of policy, picked from the endorsers found
+// by service discovery. If discovery fails, they are picked from the
+// endorsing peers in connection profile. Results are cached for ttl, and
+// concurrent selections of a chaincode share one discovery.
+type EndorserSelector struct {
+	c       *Client
+	ttl     time.Duration
+	policy  string
+	layouts []EndorserLayout
+
+	mu    sync.Mutex
+	cache map[string]cachedEndorsers
+	calls map[string]*selectCall
+}
+
+type cachedEndorsers struct {
+	peers  []fab.Peer
+	expire time.Time
+}
+
+// selectCall is an in-flight selection, done is closed when it returns
+type selectCall struct {
+	done  chan struct{}
+	peers []fab.Peer
+	err   error
+}
+
+// NewEndorserSelector creates selector, policy is the endorsement policy
+// of chaincode, e.g. "AND('Org1MSP.member','Org2MSP.member')".
+func (c *Client) NewEndorserSelector(ttl time.Duration, policy string) (*EndorserSelector, error) {
+	envelope, err := c.genPolicy(policy)
+	if err != nil {
+		return nil, errors.WithMessage(err, "gen policy from string error")
+	}
+	layouts, err := PolicyLayouts(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EndorserSelector{
+		c:       c,
+		ttl:     ttl,
+		policy:  policy,
+		layouts: layouts,
+		cache:   make(map[string]cachedEndorsers),
+		calls:   make(map[string]*selectCall),
+	}, nil
+}
+
+// Endorsers returns endorsers satisfying the policy of chaincode ccID
+func (s *EndorserSelector) Endorsers(ccID string) ([]fab.Peer, error) {
+	s.mu.Lock()
+	if ce, ok := s.cache[ccID]; ok && time.Now().Before(ce.expire) {
+		s.mu.Unlock()
+		return ce.peers, nil
+	}
+	if call, ok := s.calls[ccID]; ok {
+		s.mu.Unlock()
+		<-call.done
+		return call.peers, call.err
+	}
+	call := &selectCall{done: make(chan struct{})}
+	s.calls[ccID] = call
+	s.mu.Unlock()
+
+	// discovery is slow, other chaincodes are not blocked by it
+	call.peers, call.err = s.selectEndorsers(ccID)
+
+	s.mu.Lock()
+	delete(s.calls, ccID)
+	if call.err == nil {
+		s.cache[ccID] = cachedEndorsers{peers: call.peers, expire: time.Now().Add(s.ttl)}
+	}
+	s.mu.Unlock()
+	close(call.done)
+	return call.peers, call.err
+}
+
+// Invalidate drops the cached endorsers of ccID
+func (s *EndorserSelector) Invalidate(ccID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cache, ccID)
+}
+
+func (s *EndorserSelector) selectEndorsers(ccID string) ([]fab.Peer, error) {
+	peers, err := s.discover(ccID)
+	if err == nil {
+		if peers, ok := minimalEndorsers(s.layouts, peers); ok {
+			return peers, nil
+		}
+		err = errors.Errorf("discovered endorsers don't satisfy %s", s.policy)
+	}
+	log.Printf("Discover endorsers of %s error, fallback to connection profile: %v", ccID, err)
+
+	peers, err = s.static()
+	if err != nil {
+		return nil, err
+	}
+	if peers, ok := minimalEndorsers(s.layouts, peers); ok {
+		return peers, nil
+	}
+	return nil, errors.Errorf("no endorsing peers in connection profile satisfy %s", s.policy)
+}
+
+// discover asks service discovery for endorsers of ccID, they are the
+// peers of a layout of the policy in channel, which may be not minimal
+func (s *EndorserSelector) discover(ccID string) ([]fab.Peer, error) {
+	chCtx, err := s.c.SDK.ChannelContext(s.c.ChannelID, fabsdk.WithUser(s.c.OrgUser))()
+	if err != nil {
+		return nil, errors.WithMessage(err, "create channel context error")
+	}
+	discovery, err := chCtx.ChannelService().Discovery()
+	if err != nil {
+		return nil, errors.WithMessage(err, "get discovery service error")
+	}
+
+	selection, err := fabricselection.New(chCtx, s.c.ChannelID, discovery)
+	if err != nil {
+		return nil, errors.WithMessage(err, "create selection service error")
+	}
+	defer selection.Close()
+
+	peers, err := selection.GetEndorsersForChaincode([]*fab.ChaincodeCall{{ID: ccID}})
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, errors.Errorf("no endorser discovered for %s", ccID)
+	}
+	return peers, nil
+}
+
+// static returns the endorsing peers of connection profile
+func (s *EndorserSelector) static() ([]fab.Peer, error) {
+	candidates, err := s.c.channelPeers(func(pc fab.PeerChannelConfig) bool {
+		return pc.EndorsingPeer
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := s.c.SDK.Context(fabsdk.WithUser(s.c.OrgUser), fabsdk.WithOrg(s.c.OrgName))()
+	if err != nil {
+		return nil, errors.WithMessage(err, "create client context error")
+	}
+
+	var peers []fab.Peer
+	for _, p := range candidates {
+		peerCfg, err := comm.NetworkPeerConfig(ctx.EndpointConfig(), p.Name)
+		if err != nil {
+			return nil, err
+		}
+		peer, err := ctx.InfraProvider().CreatePeerFromConfig(peerCfg)
+		if err != nil {
+			return nil, errors.WithMessage(err, "creating peer from config failed")
+		}
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// minimalEndorsers picks peers for the first layout that candidates can
+// satisfy, layouts are sorted by size, so it's the minimal
+func minimalEndorsers(layouts []EndorserLayout, candidates []fab.Peer) ([]fab.Peer, bool) {
+	peersOf := make(map[string][]fab.Peer)
+	for _, p := range candidates {
+		peersOf[p.MSPID()] = append(peersOf[p.MSPID()], p)
+	}
+	for _, l := range layouts {
+		if peers, ok := l.pick(peersOf); ok {
+			return peers, true
+		}
+	}
+	return nil, false
+}
+
+// pick chooses peers for the layout, false if some msp has no enough peers
+func (l EndorserLayout) pick(peersOf map[string][]fab.Peer) ([]fab.Peer, bool) {
+	var peers []fab.Peer
+	for msp, n := range l {
+		if len(peersOf[msp]) < n {
+			return nil, false
+		}
+		peers = append(peers, peersOf[msp][:n]...)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].URL() < peers[j].URL()
+	})
+	return peers, true
+}
+
+// PolicyLayouts computes all layouts satisfying the signature policy,
+// sorted by size ascending
+func PolicyLayouts(envelope *common.SignaturePolicyEnvelope) ([]EndorserLayout, error) {
+	var msps []string
+	for _, id := range envelope.Identities {
+		if id.PrincipalClassification != mspproto.MSPPrincipal_ROLE {
+			return nil, errors.Errorf("unsupported principal classification %v", id.PrincipalClassification)
+		}
+		role := &mspproto.MSPRole{}
+		if err := proto.Unmarshal(id.Principal, role); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal msp role error")
+		}
+		msps = append(msps, role.MspIdentifier)
+	}
+
+	layouts, err := policyLayouts(envelope.Rule, msps)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(layouts, func(i, j int) bool {
+		return layouts[i].Size() < layouts[j].Size()
+	})
+	return layouts, nil
+}
+
+func policyLayouts(p *common.SignaturePolicy, msps []string) ([]EndorserLayout, error) {
+	switch p.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		i := int(p.GetSignedBy())
+		if i < 0 || i >= len(msps) {
+			return nil, errors.Errorf("identity index %d out of range", i)
+		}
+		return []EndorserLayout{{msps[i]: 1}}, nil
+
+	case *common.SignaturePolicy_NOutOf_:
+		nOutOf := p.GetNOutOf()
+		var subs [][]EndorserLayout
+		for _, rule := range nOutOf.Rules {
+			sub, err := policyLayouts(rule, msps)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, sub)
+		}
+		return combineLayouts(subs, int(nOutOf.N)), nil
+	}
+	return nil, errors.Errorf("unsupported signature policy type %T", p.Type)
+}
+
+// combineLayouts returns layouts satisfying n of subs
+func combineLayouts(subs [][]EndorserLayout, n int) []EndorserLayout {
+	if n <= 0 {
+		return []EndorserLayout{{}}
+	}
+	if len(subs) < n {
+		return nil
+	}
+
+	// either the first sub is used, or n of the rest are used
+	var layouts []EndorserLayout
+	for _, first := range subs[0] {
+		for _, rest := range combineLayouts(subs[1:], n-1) {
+			layouts = append(layouts, mergeLayouts(first, rest))
+		}
+	}
+	return append(layouts, combineLayouts(subs[1:], n)...)
+}
+
+func mergeLayouts(a, b EndorserLayout) EndorserLayout {
+	l := make(EndorserLayout, len(a)+len(b))
+	for msp, n := range a {
+		l[msp] += n
+	}
+	for msp, n := range b {
+		l[msp] += n
+	}
+	return l
+}
+
+// InvokeCCDiscovered is InvokeCC, but the endorsers are selected by sel.
+// The cached endorsers are dropped if some endorser is unavailable or the
+// transaction failed the endorsement policy, so next invoke selects again.
+func (c *Client) InvokeCCDiscovered(sel *EndorserSelector, opts ...InvokeOption) (fab.TransactionID, error) {
+	req, err := c.newInvokeRequest(opts)
+	if err != nil {
+		return "", err
+	}
+
+	peers, err := sel.Endorsers(req.ChaincodeID)
+	if err != nil {
+		return "", errors.WithMessage(err, "select endorsers error")
+	}
+
+	txID, err := c.executeInvoke(req, channel.WithTargets(peers...))
+	if err != nil && (isConnectionError(err) || isPolicyFailure(err)) {
+		sel.Invalidate(req.ChaincodeID)
+	}
+	return txID, err
+}
+
+func isPolicyFailure(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Group == status.EventServerStatus &&
+		s.Code == int32(pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE)
+}
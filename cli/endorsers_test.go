@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/mocks"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
+)
+
+func mockPeer(msp, url string) fab.Peer {
+	p := mocks.NewMockPeer(url, url)
+	p.SetMSPID(msp)
+	return p
+}
+
+func peerURLs(peers []fab.Peer) []string {
+	var urls []string
+	for _, p := range peers {
+		urls = append(urls, p.URL())
+	}
+	return urls
+}
+
+func TestMinimalEndorsers(t *testing.T) {
+	candidates := []fab.Peer{
+		mockPeer("Org1MSP", "peer1.org1"),
+		mockPeer("Org1MSP", "peer0.org1"),
+		mockPeer("Org2MSP", "peer0.org2"),
+		mockPeer("Org3MSP", "peer0.org3"),
+	}
+
+	tests := []struct {
+		policy string
+		peers  []fab.Peer
+		want   []string
+	}{
+		{"OR('Org1MSP.member','Org2MSP.member')", candidates, []string{"peer1.org1"}},
+		{"OR('Org3MSP.member','Org2MSP.member')", candidates, []string{"peer0.org3"}},
+		{"AND('Org1MSP.member','Org2MSP.member')", candidates, []string{"peer0.org2", "peer1.org1"}},
+		// the smallest layout is taken, not the first one of policy
+		{"OR(AND('Org1MSP.member','Org2MSP.member'),'Org3MSP.member')", candidates, []string{"peer0.org3"}},
+		{"OR(AND('Org1MSP.member','Org2MSP.member'),'Org3MSP.member')", candidates[:3], []string{"peer0.org2", "peer1.org1"}},
+		{"OutOf(2,'Org1MSP.member','Org2MSP.member','Org3MSP.member')", candidates[2:], []string{"peer0.org2", "peer0.org3"}},
+		{"AND('Org1MSP.member','Org2MSP.member')", candidates[:2], nil},
+	}
+	for _, test := range tests {
+		envelope, err := cauthdsl.FromString(test.policy)
+		if err != nil {
+			t.Fatalf("parse policy %s error: %v", test.policy, err)
+		}
+		layouts, err := PolicyLayouts(envelope)
+		if err != nil {
+			t.Fatalf("layouts of %s error: %v", test.policy, err)
+		}
+
+		peers, ok := minimalEndorsers(layouts, test.peers)
+		if ok != (test.want != nil) {
+			t.Fatalf("%s: satisfied %v, want %v", test.policy, ok, test.want != nil)
+		}
+		if got := peerURLs(peers); !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("%s: got endorsers %v, want %v", test.policy, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/pkg/errors"
+	"github.com/shitaibin/fabric-sdk-go-sample/chaincode/types"
+)
+
+// ChaincodeError is a failed response of chaincode decoded from the json
+// types.ErrorEnvelope, Status is the status of response. The errors of
+// invoke and query are converted to the typed errors below, use
+// errors.Cause to get them.
+type ChaincodeError struct {
+	Status  int32
+	Code    string
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *ChaincodeError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// InternalError is ChaincodeError of types.ErrCodeInternal
+type InternalError struct{ *ChaincodeError }
+
+// UnknownFunctionError is ChaincodeError of types.ErrCodeUnknownFunction
+type UnknownFunctionError struct{ *ChaincodeError }
+
+// InvalidArgumentError is ChaincodeError of types.ErrCodeInvalidArgument
+type InvalidArgumentError struct{ *ChaincodeError }
+
+// InvalidAmountError is ChaincodeError of types.ErrCodeInvalidAmount
+type InvalidAmountError struct{ *ChaincodeError }
+
+// AmountTooLargeError is ChaincodeError of types.ErrCodeAmountTooLarge
+type AmountTooLargeError struct{ *ChaincodeError }
+
+// InsufficientFundsError is ChaincodeError of types.ErrCodeInsufficientFunds
+type InsufficientFundsError struct{ *ChaincodeError }
+
+// NotFoundError is ChaincodeError of types.ErrCodeNotFound
+type NotFoundError struct{ *ChaincodeError }
+
+// UnauthorizedError is ChaincodeError of types.ErrCodeUnauthorized
+type UnauthorizedError struct{ *ChaincodeError }
+
+// typedError wraps e by its code, e is returned for unknown code
+func typedError(e *ChaincodeError) error {
+	switch e.Code {
+	case types.ErrCodeInternal:
+		return &InternalError{e}
+	case types.ErrCodeUnknownFunction:
+		return &UnknownFunctionError{e}
+	case types.ErrCodeInvalidArgument:
+		return &InvalidArgumentError{e}
+	case types.ErrCodeInvalidAmount:
+		return &InvalidAmountError{e}
+	case types.ErrCodeAmountTooLarge:
+		return &AmountTooLargeError{e}
+	case types.ErrCodeInsufficientFunds:
+		return &InsufficientFundsError{e}
+	case types.ErrCodeNotFound:
+		return &NotFoundError{e}
+	case types.ErrCodeUnauthorized:
+		return &UnauthorizedError{e}
+	}
+	return e
+}
+
+// DecodeChaincodeError decodes the status and message of a failed
+// response into typed error, nil if message is not an error envelope
+func DecodeChaincodeError(status int32, message string) error {
+	env := types.ErrorEnvelope{}
+	if err := json.Unmarshal([]byte(message), &env); err != nil || env.Code == "" {
+		return nil
+	}
+	return typedError(&ChaincodeError{
+		Status:  status,
+		Code:    env.Code,
+		Message: env.Message,
+		Details: env.Details,
+	})
+}
+
+// chaincodeError converts the chaincode status in err to typed error, the
+// first one is used if endorsers returned several. err is returned if it
+// has no chaincode error.
+func chaincodeError(err error) error {
+	if e := findChaincodeError(err); e != nil {
+		return e
+	}
+	return err
+}
+
+func findChaincodeError(err error) error {
+	if m, ok := errors.Cause(err).(multi.Errors); ok {
+		for _, e := range m {
+			if ce := findChaincodeError(e); ce != nil {
+				return ce
+			}
+		}
+		return nil
+	}
+
+	s, ok := status.FromError(err)
+	if !ok || s.Group != status.ChaincodeStatus {
+		return nil
+	}
+	return DecodeChaincodeError(s.Code, s.Message)
+}
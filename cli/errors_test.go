@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/pkg/errors"
+	"github.com/shitaibin/fabric-sdk-go-sample/chaincode/types"
+)
+
+func envelope(t *testing.T, code string) string {
+	t.Helper()
+	b, err := json.Marshal(types.ErrorEnvelope{Code: code, Message: "failed", Details: map[string]interface{}{"account": "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestDecodeChaincodeError(t *testing.T) {
+	ce := func(code string) *ChaincodeError {
+		return &ChaincodeError{Status: 500, Code: code, Message: "failed", Details: map[string]interface{}{"account": "a"}}
+	}
+	tests := []struct {
+		code string
+		want error
+	}{
+		{types.ErrCodeInternal, &InternalError{ce(types.ErrCodeInternal)}},
+		{types.ErrCodeUnknownFunction, &UnknownFunctionError{ce(types.ErrCodeUnknownFunction)}},
+		{types.ErrCodeInvalidArgument, &InvalidArgumentError{ce(types.ErrCodeInvalidArgument)}},
+		{types.ErrCodeInvalidAmount, &InvalidAmountError{ce(types.ErrCodeInvalidAmount)}},
+		{types.ErrCodeAmountTooLarge, &AmountTooLargeError{ce(types.ErrCodeAmountTooLarge)}},
+		{types.ErrCodeInsufficientFunds, &InsufficientFundsError{ce(types.ErrCodeInsufficientFunds)}},
+		{types.ErrCodeNotFound, &NotFoundError{ce(types.ErrCodeNotFound)}},
+		{types.ErrCodeUnauthorized, &UnauthorizedError{ce(types.ErrCodeUnauthorized)}},
+		// unknown codes are not typed
+		{"OTHER", ce("OTHER")},
+	}
+	for _, test := range tests {
+		if err := DecodeChaincodeError(500, envelope(t, test.code)); !reflect.DeepEqual(err, test.want) {
+			t.Fatalf("code %s: got %T %+v, want %T %+v", test.code, err, err, test.want, test.want)
+		}
+	}
+
+	// messages which are not envelopes are not chaincode errors
+	for _, message := range []string{"", "failed", `{"message":"failed"}`} {
+		if err := DecodeChaincodeError(500, message); err != nil {
+			t.Fatalf("message %q: got error %v, want nil", message, err)
+		}
+	}
+}
+
+func TestChaincodeErrorOfEndorsers(t *testing.T) {
+	other := errors.New("connection refused")
+	denied := status.New(status.ChaincodeStatus, 500, envelope(t, types.ErrCodeUnauthorized), nil)
+	err := chaincodeError(errors.WithMessage(multi.Errors{other, denied}, "endorse error"))
+	if _, ok := err.(*UnauthorizedError); !ok {
+		t.Fatalf("got %T %v, want UnauthorizedError", err, err)
+	}
+	if err := chaincodeError(other); err != other {
+		t.Fatalf("got %v, want error without chaincode status", err)
+	}
+}
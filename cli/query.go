@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/pkg/errors"
+)
+
+// QueryStrategy decides the order of peers to send query
+type QueryStrategy int
+
+const (
+	// RoundRobin starts from the next peer of last query
+	RoundRobin QueryStrategy = iota
+	// LeastLatency prefers the peer with lowest average latency
+	LeastLatency
+	// PreferredOrg prefers peers of a msp, round robin inside each group
+	PreferredOrg
+)
+
+// failedLatency is the latency recorded for a peer which can't be connected,
+// so least latency strategy will try it at last
+const failedLatency = 30 * time.Second
+
+// ChannelPeer is a peer of the channel in connection profile
+type ChannelPeer struct {
+	Name  string
+	MSPID string
+}
+
+// QueryResult is the result of a balanced query
+type QueryResult struct {
+	Peer    string
+	TxID    fab.TransactionID
+	Payload []byte
+	Latency time.Duration
+}
+
+// InconsistentQueryError is returned when peers returned different results
+// for the same query
+type InconsistentQueryError struct {
+	Results []QueryResult
+}
+
+func (e *InconsistentQueryError) Error() string {
+	var ps []string
+	for _, r := range e.Results {
+		ps = append(ps, fmt.Sprintf("%s=%q", r.Peer, r.Payload))
+	}
+	return "query results are inconsistent: " + strings.Join(ps, ", ")
+}
+
+// QueryBalancerOption configures QueryBalancer
+type QueryBalancerOption func(b *QueryBalancer)
+
+// WithPreferredMSP sets the msp for PreferredOrg strategy
+func WithPreferredMSP(mspID string) QueryBalancerOption {
+	return func(b *QueryBalancer) {
+		b.preferredMSP = mspID
+	}
+}
+
+// WithConsistencyCheck sends each query to n peers and fails with
+// InconsistentQueryError if their payloads differ
+func WithConsistencyCheck(n int) QueryBalancerOption {
+	return func(b *QueryBalancer) {
+		b.consistency = n
+	}
+}
+
+// QueryBalancer sends query to one of the chaincodeQuery peers of the
+// connection profile, and fails over to the next peer on connection errors.
+type QueryBalancer struct {
+	c            *Client
+	strategy     QueryStrategy
+	preferredMSP string
+	consistency  int
+
+	mu      sync.Mutex
+	peers   []ChannelPeer
+	next    int
+	latency map[string]time.Duration // moving average
+}
+
+// NewQueryBalancer loads all chaincodeQuery peers of the channel from
+// connection profile
+func (c *Client) NewQueryBalancer(strategy QueryStrategy, opts ...QueryBalancerOption) (*QueryBalancer, error) {
+	b := &QueryBalancer{
+		c:           c,
+		strategy:    strategy,
+		consistency: 1,
+		latency:     make(map[string]time.Duration),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.strategy == PreferredOrg && b.preferredMSP == "" {
+		return nil, errors.New("preferred msp is required by PreferredOrg strategy")
+	}
+
+	peers, err := c.channelPeers(func(pc fab.PeerChannelConfig) bool {
+		return pc.ChaincodeQuery
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(peers) == 0 {
+		return nil, errors.Errorf("no chaincode query peer for channel %s", c.ChannelID)
+	}
+	if b.consistency > len(peers) {
+		return nil, errors.Errorf("consistency check needs %d peers, only %d", b.consistency, len(peers))
+	}
+	b.peers = peers
+	return b, nil
+}
+
+// Peers returns the peers used by balancer
+func (b *QueryBalancer) Peers() []ChannelPeer {
+	return append([]ChannelPeer(nil), b.peers...)
+}
+
+// Query queries keys like QueryCC, but the peer is picked by balancer
+func (b *QueryBalancer) Query(keys string) (*QueryResult, error) {
+	req := channel.Request{
+		ChaincodeID: b.c.CCID,
+		Fcn:         "query",
+		Args:        packArgs([]string{keys}),
+	}
+
+	var (
+		results []QueryResult
+		errs    error
+	)
+	for _, p := range b.candidates() {
+		res, err := b.queryPeer(p, req)
+		if err != nil {
+			if !isConnectionError(err) {
+				return nil, errors.WithMessagef(err, "query chaincode on %s error", p.Name)
+			}
+			errs = multi.Append(errs, errors.WithMessage(err, p.Name))
+			continue
+		}
+
+		results = append(results, *res)
+		if len(results) == b.consistency {
+			break
+		}
+	}
+
+	if len(results) < b.consistency {
+		return nil, errors.WithMessage(errs, "no enough peer available for query")
+	}
+	for _, r := range results[1:] {
+		if !bytes.Equal(r.Payload, results[0].Payload) {
+			return nil, &InconsistentQueryError{Results: results}
+		}
+	}
+	return &results[0], nil
+}
+
+func (b *QueryBalancer) queryPeer(p ChannelPeer, req channel.Request) (*QueryResult, error) {
+	start := time.Now()
+	resp, err := b.c.cc.Query(req, channel.WithTargetEndpoints(p.Name))
+	latency := time.Since(start)
+	if err != nil {
+		if isConnectionError(err) {
+			b.record(p.Name, failedLatency)
+		}
+		return nil, err
+	}
+
+	b.record(p.Name, latency)
+	return &QueryResult{
+		Peer:    p.Name,
+		TxID:    resp.TransactionID,
+		Payload: resp.Payload,
+		Latency: latency,
+	}, nil
+}
+
+func (b *QueryBalancer) record(peer string, d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if avg, ok := b.latency[peer]; ok {
+		d = (avg*7 + d) / 8
+	}
+	b.latency[peer] = d
+}
+
+// candidates returns all peers ordered by strategy
+func (b *QueryBalancer) candidates() []ChannelPeer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(b.peers)
+	ps := make([]ChannelPeer, 0, n)
+	for i := 0; i < n; i++ {
+		ps = append(ps, b.peers[(b.next+i)%n])
+	}
+	b.next = (b.next + 1) % n
+
+	switch b.strategy {
+	case LeastLatency:
+		// peers never queried have zero latency and will be tried first
+		sort.SliceStable(ps, func(i, j int) bool {
+			return b.latency[ps[i].Name] < b.latency[ps[j].Name]
+		})
+	case PreferredOrg:
+		sort.SliceStable(ps, func(i, j int) bool {
+			return ps[i].MSPID == b.preferredMSP && ps[j].MSPID != b.preferredMSP
+		})
+	}
+	return ps
+}
+
+// channelPeers returns peers of the channel in connection profile which
+// match the filter, sorted by name
+func (c *Client) channelPeers(match func(pc fab.PeerChannelConfig) bool) ([]ChannelPeer, error) {
+	ctx, err := c.SDK.Context(fabsdk.WithUser(c.OrgUser), fabsdk.WithOrg(c.OrgName))()
+	if err != nil {
+		return nil, errors.WithMessage(err, "create client context error")
+	}
+
+	netCfg := ctx.EndpointConfig().NetworkConfig()
+	chCfg, ok := netCfg.Channels[strings.ToLower(c.ChannelID)]
+	if !ok {
+		return nil, errors.Errorf("channel %s not in connection profile", c.ChannelID)
+	}
+
+	mspOf := make(map[string]string)
+	for _, org := range netCfg.Organizations {
+		for _, p := range org.Peers {
+			mspOf[p] = org.MSPID
+		}
+	}
+
+	var peers []ChannelPeer
+	for name, pc := range chCfg.Peers {
+		if match(pc) {
+			peers = append(peers, ChannelPeer{Name: name, MSPID: mspOf[name]})
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	return peers, nil
+}
+
+// isConnectionError reports whether err is caused by peer unavailable
+func isConnectionError(err error) bool {
+	if m, ok := errors.Cause(err).(multi.Errors); ok {
+		for _, e := range m {
+			if isConnectionError(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Group {
+	case status.GRPCTransportStatus:
+		return true
+	case status.EndorserClientStatus, status.ClientStatus:
+		return s.Code == status.ConnectionFailed.ToInt32() || s.Code == status.Timeout.ToInt32()
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+package cli
+
+import "github.com/shitaibin/fabric-sdk-go-sample/rwset"
+
+// Read write set types, they are decoded by package rwset
+type (
+	NsReadWriteSet = rwset.NsReadWriteSet
+	KVRead         = rwset.KVRead
+	KVWrite        = rwset.KVWrite
+)
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+	"github.com/shitaibin/fabric-sdk-go-sample/rwset"
+)
+
+// Simulation is what a transaction would do if it's submitted
+type Simulation struct {
+	TxID            fab.TransactionID
+	ChaincodeStatus int32
+	Payload         []byte
+	RWSets          []NsReadWriteSet
+
+	// Event is the chaincode event, nil if not set. Fabric only keeps the
+	// last event set by chaincode in a transaction.
+	Event *pb.ChaincodeEvent
+}
+
+// Namespace returns the read write set of chaincode ns
+func (s *Simulation) Namespace(ns string) NsReadWriteSet {
+	for _, set := range s.RWSets {
+		if set.Namespace == ns {
+			return set
+		}
+	}
+	return NsReadWriteSet{Namespace: ns}
+}
+
+// Simulate endorses the proposal of calling fcn with args, but never
+// submits it to orderer, so you can preview what the transaction would
+// change. Deleted keys are writes with IsDelete set.
+func (c *Client) Simulate(fcn string, args []string, peers []string, opts ...InvokeOption) (*Simulation, error) {
+	req := channel.Request{
+		ChaincodeID: c.CCID,
+		Fcn:         fcn,
+		Args:        packArgs(args),
+	}
+	if err := applyInvokeOptions(&req, opts); err != nil {
+		return nil, err
+	}
+
+	var reqOpts []channel.RequestOption
+	if len(peers) > 0 {
+		reqOpts = append(reqOpts, channel.WithTargetEndpoints(peers...))
+	}
+
+	// endorse and validate, without commit handler
+	handler := invoke.NewSelectAndEndorseHandler(
+		NewEndorsementCompareHandler(
+			invoke.NewEndorsementValidationHandler(
+				invoke.NewSignatureValidationHandler(),
+			),
+		),
+	)
+	resp, err := c.cc.InvokeHandler(handler, req, reqOpts...)
+	if err != nil {
+		return nil, errors.WithMessage(err, "simulate chaincode error")
+	}
+	if len(resp.Responses) == 0 {
+		return nil, errors.New("simulate chaincode error: no endorsement")
+	}
+
+	ca, err := rwset.UnmarshalChaincodeAction(resp.Responses[0].Payload)
+	if err != nil {
+		return nil, err
+	}
+	sets, err := rwset.UnmarshalTxReadWriteSet(ca.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &Simulation{
+		TxID:            resp.TransactionID,
+		ChaincodeStatus: resp.ChaincodeStatus,
+		Payload:         resp.Payload,
+		RWSets:          sets,
+	}
+	if len(ca.Events) > 0 {
+		event := &pb.ChaincodeEvent{}
+		if err := proto.Unmarshal(ca.Events, event); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal chaincode event error")
+		}
+		if event.EventName != "" {
+			sim.Event = event
+		}
+	}
+	return sim, nil
+}
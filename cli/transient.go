@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/pkg/errors"
+)
+
+// TransientMap is the private data of a proposal, it is sent to endorsers
+// but never written to the ledger. Printing it only shows the keys and the
+// size of each value, so the values never appear in client logs.
+type TransientMap map[string][]byte
+
+// String redacts all values of the map
+func (tm TransientMap) String() string {
+	keys := make([]string, 0, len(tm))
+	for k := range tm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("%s:<redacted %d bytes>", k, len(tm[k])))
+	}
+	return "map[" + strings.Join(fields, " ") + "]"
+}
+
+// GoString makes %#v redacted too
+func (tm TransientMap) GoString() string {
+	return tm.String()
+}
+
+// TransientFromStruct encodes every field of v into a transient field, the
+// key is the json name of the field and the value is the json encoding of
+// the field's value.
+func TransientFromStruct(v interface{}) (TransientMap, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.WithMessage(err, "marshal transient struct error")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, errors.WithMessage(err, "transient value should be a struct or map")
+	}
+
+	tm := make(TransientMap, len(fields))
+	for k, f := range fields {
+		tm[k] = []byte(f)
+	}
+	return tm, nil
+}
+
+// InvokeOption sets optional fields of the invoke request
+type InvokeOption func(req *channel.Request) error
+
+// WithTransient adds a transient field to the request
+func WithTransient(key string, value []byte) InvokeOption {
+	return func(req *channel.Request) error {
+		if key == "" {
+			return errors.New("transient key is empty")
+		}
+		if req.TransientMap == nil {
+			req.TransientMap = make(map[string][]byte)
+		}
+		req.TransientMap[key] = value
+		return nil
+	}
+}
+
+// WithTransientMap adds all fields of tm to the request
+func WithTransientMap(tm TransientMap) InvokeOption {
+	return func(req *channel.Request) error {
+		for k, v := range tm {
+			if err := WithTransient(k, v)(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithTransientJSON adds v as a json encoded transient field
+func WithTransientJSON(key string, v interface{}) InvokeOption {
+	return func(req *channel.Request) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return errors.WithMessage(err, "marshal transient field error")
+		}
+		return WithTransient(key, b)(req)
+	}
+}
+
+// WithTransientStruct adds every field of v as a transient field,
+// see TransientFromStruct.
+func WithTransientStruct(v interface{}) InvokeOption {
+	return func(req *channel.Request) error {
+		tm, err := TransientFromStruct(v)
+		if err != nil {
+			return err
+		}
+		return WithTransientMap(tm)(req)
+	}
+}
+
+func applyInvokeOptions(req *channel.Request, opts []InvokeOption) error {
+	for _, opt := range opts {
+		if err := opt(req); err != nil {
+			return errors.WithMessage(err, "apply invoke option error")
+		}
+	}
+	return nil
+}
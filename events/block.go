@@ -0,0 +1,223 @@
+package events
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	mspproto "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+	"github.com/shitaibin/fabric-sdk-go-sample/rwset"
+)
+
+// Block is the decoded block
+type Block struct {
+	Number       uint64
+	DataHash     []byte
+	PreviousHash []byte
+	Transactions []*Transaction
+}
+
+// Transaction is the decoded transaction of block, Actions are only
+// decoded for endorser transactions
+type Transaction struct {
+	Index          int
+	TxID           string
+	ChannelID      string
+	Type           common.HeaderType
+	Timestamp      time.Time
+	Creator        Identity
+	ValidationCode pb.TxValidationCode
+	Actions        []*Action
+}
+
+// Valid reports whether the transaction was committed as valid
+func (t *Transaction) Valid() bool {
+	return t.ValidationCode == pb.TxValidationCode_VALID
+}
+
+// Action is a chaincode invocation of transaction
+type Action struct {
+	ChaincodeID string
+	Version     string
+	Function    string
+	Args        [][]byte
+	RWSets      []rwset.NsReadWriteSet
+	Endorsers   []Identity
+	Event       *pb.ChaincodeEvent
+}
+
+// Identity is a serialized identity, Cert is nil if the identity is not a
+// x509 certificate
+type Identity struct {
+	MSPID string
+	Cert  *x509.Certificate
+}
+
+// DecodeBlock decodes transactions of block
+func DecodeBlock(b *common.Block) (*Block, error) {
+	if b.Header == nil || b.Data == nil {
+		return nil, errors.New("block header or data is nil")
+	}
+
+	var filter []byte
+	if b.Metadata != nil && len(b.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = b.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+	}
+
+	block := &Block{
+		Number:       b.Header.Number,
+		DataHash:     b.Header.DataHash,
+		PreviousHash: b.Header.PreviousHash,
+	}
+	for i, data := range b.Data.Data {
+		tx, err := decodeTransaction(data)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "decode tx %d of block %d error", i, b.Header.Number)
+		}
+		tx.Index = i
+		// the bitmap has a validation code for each transaction
+		if i < len(filter) {
+			tx.ValidationCode = pb.TxValidationCode(filter[i])
+		} else {
+			tx.ValidationCode = pb.TxValidationCode_NOT_VALIDATED
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+	return block, nil
+}
+
+func decodeTransaction(data []byte) (*Transaction, error) {
+	env := &common.Envelope{}
+	if err := proto.Unmarshal(data, env); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal envelope error")
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.Payload, payload); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal payload error")
+	}
+	if payload.Header == nil {
+		return nil, errors.New("payload header is nil")
+	}
+
+	chHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, chHeader); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal channel header error")
+	}
+	sigHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(payload.Header.SignatureHeader, sigHeader); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal signature header error")
+	}
+	creator, err := decodeIdentity(sigHeader.Creator)
+	if err != nil {
+		return nil, errors.WithMessage(err, "decode creator error")
+	}
+
+	tx := &Transaction{
+		TxID:      chHeader.TxId,
+		ChannelID: chHeader.ChannelId,
+		Type:      common.HeaderType(chHeader.Type),
+		Creator:   creator,
+	}
+	if chHeader.Timestamp != nil {
+		if tx.Timestamp, err = ptypes.Timestamp(chHeader.Timestamp); err != nil {
+			return nil, errors.WithMessage(err, "convert timestamp error")
+		}
+	}
+	if tx.Type != common.HeaderType_ENDORSER_TRANSACTION {
+		return tx, nil
+	}
+
+	ptx := &pb.Transaction{}
+	if err := proto.Unmarshal(payload.Data, ptx); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal transaction error")
+	}
+	for i, ta := range ptx.Actions {
+		action, err := decodeAction(ta)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "decode action %d error", i)
+		}
+		tx.Actions = append(tx.Actions, action)
+	}
+	return tx, nil
+}
+
+func decodeAction(ta *pb.TransactionAction) (*Action, error) {
+	ccPayload := &pb.ChaincodeActionPayload{}
+	if err := proto.Unmarshal(ta.Payload, ccPayload); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal chaincode action payload error")
+	}
+
+	action := &Action{}
+
+	// the proposal payload holds the invocation, i.e. function and args
+	cpp := &pb.ChaincodeProposalPayload{}
+	if err := proto.Unmarshal(ccPayload.ChaincodeProposalPayload, cpp); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal chaincode proposal payload error")
+	}
+	cis := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(cpp.Input, cis); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal chaincode invocation spec error")
+	}
+	if spec := cis.ChaincodeSpec; spec != nil {
+		if spec.ChaincodeId != nil {
+			action.ChaincodeID = spec.ChaincodeId.Name
+		}
+		if spec.Input != nil && len(spec.Input.Args) > 0 {
+			action.Function = string(spec.Input.Args[0])
+			action.Args = spec.Input.Args[1:]
+		}
+	}
+
+	if ccPayload.Action == nil {
+		return action, nil
+	}
+
+	// the endorsed action holds the results, i.e. read write sets and event
+	ca, err := rwset.UnmarshalChaincodeAction(ccPayload.Action.ProposalResponsePayload)
+	if err != nil {
+		return nil, err
+	}
+	if ca.ChaincodeId != nil {
+		action.Version = ca.ChaincodeId.Version
+	}
+	if action.RWSets, err = rwset.UnmarshalTxReadWriteSet(ca.Results); err != nil {
+		return nil, err
+	}
+	if len(ca.Events) > 0 {
+		action.Event = &pb.ChaincodeEvent{}
+		if err := proto.Unmarshal(ca.Events, action.Event); err != nil {
+			return nil, errors.WithMessage(err, "unmarshal chaincode event error")
+		}
+	}
+
+	for _, e := range ccPayload.Action.Endorsements {
+		id, err := decodeIdentity(e.Endorser)
+		if err != nil {
+			return nil, errors.WithMessage(err, "decode endorser error")
+		}
+		action.Endorsers = append(action.Endorsers, id)
+	}
+	return action, nil
+}
+
+// decodeIdentity decodes serialized identity, the certificate is parsed if
+// it's a pem encoded x509 certificate
+func decodeIdentity(b []byte) (Identity, error) {
+	sid := &mspproto.SerializedIdentity{}
+	if err := proto.Unmarshal(b, sid); err != nil {
+		return Identity{}, errors.WithMessage(err, "unmarshal serialized identity error")
+	}
+
+	id := Identity{MSPID: sid.Mspid}
+	if block, _ := pem.Decode(sid.IdBytes); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			id.Cert = cert
+		}
+	}
+	return id, nil
+}
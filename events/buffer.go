@@ -0,0 +1,394 @@
+package events
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// OverflowStrategy decides what to do with a new event when buffer is full
+type OverflowStrategy int
+
+const (
+	// BlockProducer waits until there is room, the event service is blocked
+	// too, so use it with dispatcher.WithEventConsumerTimeout(0), or the
+	// event service drops events after timeout
+	BlockProducer OverflowStrategy = iota
+	// DropOldest drops the oldest buffered event
+	DropOldest
+	// SpillToDisk writes events to a temp file, they are delivered after
+	// the buffered events
+	SpillToDisk
+)
+
+// BufferConfig configures buffer, SpillDir is the dir of temp file for
+// SpillToDisk, default is the system temp dir
+type BufferConfig struct {
+	Size     int
+	Strategy OverflowStrategy
+	SpillDir string
+}
+
+// BufferMetrics is a snapshot of buffer counters, Depth counts both
+// buffered and spilled events
+type BufferMetrics struct {
+	Depth     int
+	MaxDepth  int
+	Enqueued  uint64
+	Delivered uint64
+	Dropped   uint64
+	Spilled   uint64
+}
+
+// Buffer decouples event service from a slow handler: events are queued
+// and delivered to the handler in order by a goroutine.
+type Buffer struct {
+	cfg     BufferConfig
+	deliver func(v interface{})
+	codec   eventCodec
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []interface{}
+	spill   *spillFile
+	closed  bool
+	metrics BufferMetrics
+	done    chan struct{}
+}
+
+func newBuffer(cfg BufferConfig, codec eventCodec, deliver func(v interface{})) (*Buffer, error) {
+	if cfg.Size <= 0 {
+		return nil, errors.Errorf("invalid buffer size %d", cfg.Size)
+	}
+
+	b := &Buffer{
+		cfg:     cfg,
+		deliver: deliver,
+		codec:   codec,
+		done:    make(chan struct{}),
+	}
+	b.cond = sync.NewCond(&b.mu)
+	if cfg.Strategy == SpillToDisk {
+		spill, err := newSpillFile(cfg.SpillDir)
+		if err != nil {
+			return nil, err
+		}
+		b.spill = spill
+	}
+
+	go b.run()
+	return b, nil
+}
+
+// NewBlockBuffer creates buffer for block handler h, the returned handler
+// queues events to the buffer
+func NewBlockBuffer(h BlockHandler, cfg BufferConfig) (*Buffer, BlockHandler, error) {
+	b, err := newBuffer(cfg, blockCodec, func(v interface{}) { h(v.(*fab.BlockEvent)) })
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, func(e *fab.BlockEvent) { b.push(e) }, nil
+}
+
+// NewFilteredBlockBuffer is NewBlockBuffer for filtered block handler
+func NewFilteredBlockBuffer(h FilteredBlockHandler, cfg BufferConfig) (*Buffer, FilteredBlockHandler, error) {
+	b, err := newBuffer(cfg, filteredBlockCodec, func(v interface{}) { h(v.(*fab.FilteredBlockEvent)) })
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, func(e *fab.FilteredBlockEvent) { b.push(e) }, nil
+}
+
+// NewTxStatusBuffer is NewBlockBuffer for tx status handler
+func NewTxStatusBuffer(h TxStatusHandler, cfg BufferConfig) (*Buffer, TxStatusHandler, error) {
+	b, err := newBuffer(cfg, jsonCodec(func() interface{} { return &fab.TxStatusEvent{} }),
+		func(v interface{}) { h(v.(*fab.TxStatusEvent)) })
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, func(e *fab.TxStatusEvent) { b.push(e) }, nil
+}
+
+// NewChaincodeBuffer is NewBlockBuffer for chaincode handler
+func NewChaincodeBuffer(h ChaincodeHandler, cfg BufferConfig) (*Buffer, ChaincodeHandler, error) {
+	b, err := newBuffer(cfg, jsonCodec(func() interface{} { return &fab.CCEvent{} }),
+		func(v interface{}) { h(v.(*fab.CCEvent)) })
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, func(e *fab.CCEvent) { b.push(e) }, nil
+}
+
+// Metrics returns the counters of buffer
+func (b *Buffer) Metrics() BufferMetrics {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.metrics
+}
+
+// Close stops accepting events, and waits the queued events delivered
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	<-b.done
+	if b.spill != nil {
+		return b.spill.close()
+	}
+	return nil
+}
+
+func (b *Buffer) depth() int {
+	n := len(b.queue)
+	if b.spill != nil {
+		n += b.spill.count
+	}
+	return n
+}
+
+func (b *Buffer) push(v interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		b.metrics.Dropped++
+		return
+	}
+	b.metrics.Enqueued++
+
+	switch {
+	// keep order, newer events go to disk while there are spilled events
+	case b.spill != nil && b.spill.count > 0:
+		b.spillEvent(v)
+	case len(b.queue) < b.cfg.Size:
+		b.queue = append(b.queue, v)
+	case b.cfg.Strategy == BlockProducer:
+		for len(b.queue) >= b.cfg.Size && !b.closed {
+			b.cond.Wait()
+		}
+		b.queue = append(b.queue, v)
+	case b.cfg.Strategy == DropOldest:
+		b.queue[0] = nil
+		b.queue = append(b.queue[1:], v)
+		b.metrics.Dropped++
+	default:
+		b.spillEvent(v)
+	}
+
+	b.metrics.Depth = b.depth()
+	if b.metrics.Depth > b.metrics.MaxDepth {
+		b.metrics.MaxDepth = b.metrics.Depth
+	}
+	b.cond.Broadcast()
+}
+
+func (b *Buffer) spillEvent(v interface{}) {
+	data, err := b.codec.encode(v)
+	if err == nil {
+		err = b.spill.write(data)
+	}
+	if err != nil {
+		log.Printf("Spill event error, event dropped: %v", err)
+		b.metrics.Dropped++
+		return
+	}
+	b.metrics.Spilled++
+}
+
+// next waits and pops the next event, false if buffer is closed and empty
+func (b *Buffer) next() (interface{}, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		for b.depth() == 0 && !b.closed {
+			b.cond.Wait()
+		}
+		if b.depth() == 0 {
+			return nil, false
+		}
+
+		var v interface{}
+		if len(b.queue) > 0 {
+			v = b.queue[0]
+			b.queue[0] = nil
+			b.queue = b.queue[1:]
+		} else {
+			spilled := b.spill.count
+			data, err := b.spill.read()
+			if err != nil {
+				log.Printf("Read spill file error, %d spilled events dropped: %v", spilled, err)
+				b.metrics.Dropped += uint64(spilled)
+				b.metrics.Depth = b.depth()
+				continue
+			}
+			if v, err = b.codec.decode(data); err != nil {
+				log.Printf("Decode spilled event error, event dropped: %v", err)
+				b.metrics.Dropped++
+				b.metrics.Depth = b.depth()
+				continue
+			}
+		}
+		b.metrics.Depth = b.depth()
+		b.cond.Broadcast()
+		return v, true
+	}
+}
+
+func (b *Buffer) run() {
+	defer close(b.done)
+
+	for {
+		v, ok := b.next()
+		if !ok {
+			return
+		}
+		b.deliver(v)
+
+		b.mu.Lock()
+		b.metrics.Delivered++
+		b.mu.Unlock()
+	}
+}
+
+// eventCodec serializes events for spilling
+type eventCodec struct {
+	encode func(v interface{}) ([]byte, error)
+	decode func(data []byte) (interface{}, error)
+}
+
+func jsonCodec(newEvent func() interface{}) eventCodec {
+	return eventCodec{
+		encode: json.Marshal,
+		decode: func(data []byte) (interface{}, error) {
+			v := newEvent()
+			err := json.Unmarshal(data, v)
+			return v, err
+		},
+	}
+}
+
+// protoEvent is the spilled block or filtered block event, the block is
+// marshaled by protobuf
+type protoEvent struct {
+	SourceURL string `json:"sourceURL"`
+	Block     []byte `json:"block"`
+}
+
+var blockCodec = eventCodec{
+	encode: func(v interface{}) ([]byte, error) {
+		e := v.(*fab.BlockEvent)
+		b, err := proto.Marshal(e.Block)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(protoEvent{SourceURL: e.SourceURL, Block: b})
+	},
+	decode: func(data []byte) (interface{}, error) {
+		pe := protoEvent{}
+		if err := json.Unmarshal(data, &pe); err != nil {
+			return nil, err
+		}
+		block := &common.Block{}
+		if err := proto.Unmarshal(pe.Block, block); err != nil {
+			return nil, err
+		}
+		return &fab.BlockEvent{Block: block, SourceURL: pe.SourceURL}, nil
+	},
+}
+
+var filteredBlockCodec = eventCodec{
+	encode: func(v interface{}) ([]byte, error) {
+		e := v.(*fab.FilteredBlockEvent)
+		b, err := proto.Marshal(e.FilteredBlock)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(protoEvent{SourceURL: e.SourceURL, Block: b})
+	},
+	decode: func(data []byte) (interface{}, error) {
+		pe := protoEvent{}
+		if err := json.Unmarshal(data, &pe); err != nil {
+			return nil, err
+		}
+		block := &pb.FilteredBlock{}
+		if err := proto.Unmarshal(pe.Block, block); err != nil {
+			return nil, err
+		}
+		return &fab.FilteredBlockEvent{FilteredBlock: block, SourceURL: pe.SourceURL}, nil
+	},
+}
+
+// spillFile is a fifo of length prefixed records in a temp file, the file
+// is truncated when all records are read
+type spillFile struct {
+	f        *os.File
+	readOff  int64
+	writeOff int64
+	count    int
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := ioutil.TempFile(dir, "event-spill-")
+	if err != nil {
+		return nil, errors.WithMessage(err, "create spill file error")
+	}
+	return &spillFile{f: f}, nil
+}
+
+func (s *spillFile) write(data []byte) error {
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	if _, err := s.f.WriteAt(buf, s.writeOff); err != nil {
+		return err
+	}
+	s.writeOff += int64(len(buf))
+	s.count++
+	return nil
+}
+
+// read pops the first record, all records are dropped if it fails
+func (s *spillFile) read() ([]byte, error) {
+	var size [4]byte
+	if _, err := s.f.ReadAt(size[:], s.readOff); err != nil {
+		s.reset()
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := s.f.ReadAt(data, s.readOff+4); err != nil {
+		s.reset()
+		return nil, err
+	}
+	s.readOff += 4 + int64(len(data))
+	s.count--
+
+	if s.count == 0 {
+		s.reset()
+	}
+	return data, nil
+}
+
+func (s *spillFile) reset() {
+	s.readOff, s.writeOff, s.count = 0, 0, 0
+	if err := s.f.Truncate(0); err != nil {
+		log.Printf("Truncate spill file error: %v", err)
+	}
+}
+
+func (s *spillFile) close() error {
+	s.f.Close()
+	return os.Remove(s.f.Name())
+}
@@ -0,0 +1,160 @@
+package events
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+)
+
+// slowHandler holds the first event until release is called, so events
+// pushed meanwhile overflow the buffer
+type slowHandler struct {
+	started chan struct{}
+	gate    chan struct{}
+
+	mu        sync.Mutex
+	delivered []uint64
+}
+
+func newSlowHandler() *slowHandler {
+	return &slowHandler{
+		started: make(chan struct{}),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (h *slowHandler) handle(e *fab.BlockEvent) {
+	h.mu.Lock()
+	first := len(h.delivered) == 0
+	h.delivered = append(h.delivered, e.Block.Header.Number)
+	h.mu.Unlock()
+
+	if first {
+		close(h.started)
+		<-h.gate
+	}
+}
+
+func (h *slowHandler) release() {
+	close(h.gate)
+}
+
+func (h *slowHandler) numbers() []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.delivered...)
+}
+
+func blockEvent(num uint64) *fab.BlockEvent {
+	return &fab.BlockEvent{
+		Block: &common.Block{
+			Header: &common.BlockHeader{Number: num},
+			Data:   &common.BlockData{},
+		},
+		SourceURL: "peer0",
+	}
+}
+
+// startBuffer creates buffer of size 2, and pushes block 0 which is held by
+// the handler
+func startBuffer(t *testing.T, cfg BufferConfig) (*Buffer, BlockHandler, *slowHandler) {
+	h := newSlowHandler()
+	cfg.Size = 2
+	b, push, err := NewBlockBuffer(h.handle, cfg)
+	if err != nil {
+		t.Fatalf("create buffer error: %v", err)
+	}
+	push(blockEvent(0))
+	<-h.started
+	return b, push, h
+}
+
+func assertMetrics(t *testing.T, got, want BufferMetrics) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("got metrics %+v, want %+v", got, want)
+	}
+}
+
+func assertDelivered(t *testing.T, h *slowHandler, want []uint64) {
+	t.Helper()
+	if got := h.numbers(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("delivered blocks %v, want %v", got, want)
+	}
+}
+
+func TestBufferBlockProducer(t *testing.T) {
+	b, push, h := startBuffer(t, BufferConfig{Strategy: BlockProducer})
+	push(blockEvent(1))
+	push(blockEvent(2))
+
+	pushed := make(chan struct{})
+	go func() {
+		push(blockEvent(3))
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push to full buffer should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assertMetrics(t, b.Metrics(), BufferMetrics{Depth: 2, MaxDepth: 2, Enqueued: 4})
+
+	h.release()
+	<-pushed
+	if err := b.Close(); err != nil {
+		t.Fatalf("close buffer error: %v", err)
+	}
+	assertDelivered(t, h, []uint64{0, 1, 2, 3})
+	assertMetrics(t, b.Metrics(), BufferMetrics{Depth: 0, MaxDepth: 2, Enqueued: 4, Delivered: 4})
+}
+
+func TestBufferDropOldest(t *testing.T) {
+	b, push, h := startBuffer(t, BufferConfig{Strategy: DropOldest})
+	for i := uint64(1); i <= 4; i++ {
+		push(blockEvent(i))
+	}
+	assertMetrics(t, b.Metrics(), BufferMetrics{Depth: 2, MaxDepth: 2, Enqueued: 5, Dropped: 2})
+
+	h.release()
+	if err := b.Close(); err != nil {
+		t.Fatalf("close buffer error: %v", err)
+	}
+	assertDelivered(t, h, []uint64{0, 3, 4})
+	assertMetrics(t, b.Metrics(), BufferMetrics{Depth: 0, MaxDepth: 2, Enqueued: 5, Delivered: 3, Dropped: 2})
+}
+
+func TestBufferSpillToDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buffer-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, push, h := startBuffer(t, BufferConfig{Strategy: SpillToDisk, SpillDir: dir})
+	for i := uint64(1); i <= 4; i++ {
+		push(blockEvent(i))
+	}
+	assertMetrics(t, b.Metrics(), BufferMetrics{Depth: 4, MaxDepth: 4, Enqueued: 5, Spilled: 2})
+
+	h.release()
+	if err := b.Close(); err != nil {
+		t.Fatalf("close buffer error: %v", err)
+	}
+	assertDelivered(t, h, []uint64{0, 1, 2, 3, 4})
+	assertMetrics(t, b.Metrics(), BufferMetrics{Depth: 0, MaxDepth: 4, Enqueued: 5, Delivered: 5, Spilled: 2})
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("spill file is not removed after close: %v", files[0].Name())
+	}
+}
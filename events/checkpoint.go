@@ -0,0 +1,208 @@
+package events
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Checkpoint is the position of the last processed event of a subscription
+type Checkpoint struct {
+	BlockNum uint64 `json:"blockNum"`
+	// TxIndex is the index of last processed transaction in the block,
+	// -1 means no transaction of the block was processed
+	TxIndex int `json:"txIndex"`
+	// Complete means the whole block was processed
+	Complete bool `json:"complete"`
+}
+
+// resume returns the block to deliver from, and the last processed tx
+// index of that block
+func (cp *Checkpoint) resume() (uint64, int) {
+	if cp == nil {
+		return 0, -1
+	}
+	if cp.Complete {
+		return cp.BlockNum + 1, -1
+	}
+	return cp.BlockNum, cp.TxIndex
+}
+
+// CheckpointTx saves checkpoints in a transaction, they are committed or
+// rolled back with the other writes of the transaction
+type CheckpointTx interface {
+	Save(name string, cp Checkpoint) error
+}
+
+// Checkpointer stores the checkpoint of each subscription by name, Save
+// of it commits the checkpoint by itself
+type Checkpointer interface {
+	// Load returns nil checkpoint if name has no checkpoint
+	Load(name string) (*Checkpoint, error)
+	Save(name string, cp Checkpoint) error
+	Close() error
+}
+
+// FileCheckpointer saves checkpoint of each subscription in a json file
+type FileCheckpointer struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileCheckpointer creates checkpoint files in dir
+func NewFileCheckpointer(dir string) (*FileCheckpointer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithMessage(err, "create checkpoint dir error")
+	}
+	return &FileCheckpointer{dir: dir}, nil
+}
+
+func (f *FileCheckpointer) path(name string) string {
+	return filepath.Join(f.dir, url.PathEscape(name)+".json")
+}
+
+// Load reads the checkpoint file of name
+func (f *FileCheckpointer) Load(name string) (*Checkpoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := ioutil.ReadFile(f.path(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "read checkpoint error")
+	}
+
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal checkpoint error")
+	}
+	return cp, nil
+}
+
+// Save writes checkpoint to a temp file and renames it, so the checkpoint
+// file is never partially written
+func (f *FileCheckpointer) Save(name string, cp Checkpoint) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return errors.WithMessage(err, "marshal checkpoint error")
+	}
+
+	tmp, err := ioutil.TempFile(f.dir, ".checkpoint-")
+	if err != nil {
+		return errors.WithMessage(err, "create temp checkpoint error")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.WithMessage(err, "write checkpoint error")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.WithMessage(err, "sync checkpoint error")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithMessage(err, "close checkpoint error")
+	}
+	if err := os.Rename(tmp.Name(), f.path(name)); err != nil {
+		return errors.WithMessage(err, "rename checkpoint error")
+	}
+	return nil
+}
+
+// Close does nothing, files are closed after each operation
+func (f *FileCheckpointer) Close() error {
+	return nil
+}
+
+var checkpointBucket = []byte("checkpoints")
+
+// BoltCheckpointer saves checkpoints in a bolt database, handlers can keep
+// their effects in the same database, and save checkpoints with them by
+// Update for exactly-once processing.
+type BoltCheckpointer struct {
+	db *bolt.DB
+}
+
+// NewBoltCheckpointer opens or creates the bolt database at path
+func NewBoltCheckpointer(path string) (*BoltCheckpointer, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.WithMessage(err, "open checkpoint db error")
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(checkpointBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.WithMessage(err, "create checkpoint bucket error")
+	}
+	return &BoltCheckpointer{db: db}, nil
+}
+
+// Load reads the checkpoint of name
+func (b *BoltCheckpointer) Load(name string) (*Checkpoint, error) {
+	var cp *Checkpoint
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(checkpointBucket).Get([]byte(name))
+		if v == nil {
+			return nil
+		}
+		cp = &Checkpoint{}
+		return json.Unmarshal(v, cp)
+	})
+	if err != nil {
+		return nil, errors.WithMessage(err, "load checkpoint error")
+	}
+	return cp, nil
+}
+
+// Save writes the checkpoint of name in a transaction
+func (b *BoltCheckpointer) Save(name string, cp Checkpoint) error {
+	return b.Update(func(tx *bolt.Tx, cpTx CheckpointTx) error {
+		return cpTx.Save(name, cp)
+	})
+}
+
+// Update runs fn in a transaction of the database, the writes of fn by tx
+// and the checkpoints saved by cpTx are committed together, or all rolled
+// back if fn fails. Bucket "checkpoints" is used by checkpointer.
+func (b *BoltCheckpointer) Update(fn func(tx *bolt.Tx, cpTx CheckpointTx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx, boltCheckpointTx{tx: tx})
+	})
+}
+
+type boltCheckpointTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltCheckpointTx) Save(name string, cp Checkpoint) error {
+	v, err := json.Marshal(cp)
+	if err != nil {
+		return errors.WithMessage(err, "marshal checkpoint error")
+	}
+	if err := t.tx.Bucket(checkpointBucket).Put([]byte(name), v); err != nil {
+		return errors.WithMessage(err, "save checkpoint error")
+	}
+	return nil
+}
+
+// Close closes the database
+func (b *BoltCheckpointer) Close() error {
+	return b.db.Close()
+}
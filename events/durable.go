@@ -0,0 +1,186 @@
+package events
+
+import (
+	"log"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/options"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	eventclient "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/client"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient/seek"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/dispatcher"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/pkg/errors"
+)
+
+// TxProgress records which transactions of a block were processed, so a
+// handler can skip them when the block is delivered again after restart.
+type TxProgress struct {
+	name     string
+	cp       Checkpointer
+	blockNum uint64
+	last     int
+	complete bool
+}
+
+// Processed reports whether the tx was processed before
+func (p *TxProgress) Processed(txIndex int) bool {
+	return txIndex <= p.last
+}
+
+// Commit records the tx as processed in tx, the transaction of the effects
+// of the tx, so the tx is processed exactly once. Nil tx saves it by the
+// checkpointer of subscription right away, the tx is processed again if
+// the process stops before it.
+func (p *TxProgress) Commit(tx CheckpointTx, txIndex int) error {
+	if err := p.store(tx).Save(p.name, Checkpoint{BlockNum: p.blockNum, TxIndex: txIndex}); err != nil {
+		return err
+	}
+	p.last = txIndex
+	return nil
+}
+
+// Complete records the whole block as processed in tx, the transaction of
+// the last effects of the block. Nil tx is same as not calling it, the
+// subscription saves the checkpoint after handler returns.
+func (p *TxProgress) Complete(tx CheckpointTx) error {
+	if tx == nil {
+		return nil
+	}
+	if err := tx.Save(p.name, Checkpoint{BlockNum: p.blockNum, TxIndex: p.last, Complete: true}); err != nil {
+		return err
+	}
+	p.complete = true
+	return nil
+}
+
+func (p *TxProgress) store(tx CheckpointTx) CheckpointTx {
+	if tx == nil {
+		return p.cp
+	}
+	return tx
+}
+
+// CheckpointHandler handles a block, transactions which p reports
+// processed should be skipped. Handler gets exactly-once semantics by
+// saving the checkpoint in the transaction of its effects, with Commit of
+// each tx and Complete of the block, e.g. in BoltCheckpointer.Update. If
+// handler doesn't call Complete, the block is checkpointed after handler
+// returns nil, and is delivered again if the process stops in between.
+type CheckpointHandler func(e *fab.BlockEvent, p *TxProgress) error
+
+// SubscribeCheckpointed subscribes block events of channel from the block
+// after the checkpoint of name, or from the genesis block if there is no
+// checkpoint. Every transaction is handled exactly once across restarts
+// when handler saves checkpoints with its effects, see CheckpointHandler.
+// If handler or saving checkpoint fails, the subscription unregisters and
+// stops by itself, Done is closed and Err returns the error. The block is
+// delivered again from the checkpoint at next Start.
+func (s *Subscriber) SubscribeCheckpointed(channelID, name string, cp Checkpointer, h CheckpointHandler) (*Subscription, error) {
+	// every start creates a new deliver client seeking from the checkpoint
+	connect := func(from uint64) (fab.EventService, func(), error) {
+		dc, err := s.newDeliverClient(channelID, nil,
+			eventclient.WithBlockEvents(),
+			deliverclient.WithSeekType(seek.FromBlock),
+			deliverclient.WithBlockNum(from),
+			// block the dispatcher instead of dropping events for slow handler
+			dispatcher.WithEventConsumerTimeout(0))
+		if err != nil {
+			return nil, nil, err
+		}
+		return dc, dc.Close, nil
+	}
+	sub := newCheckpointedSubscription(name, cp, h, connect)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, sub)
+	return sub, nil
+}
+
+// newCheckpointedSubscription creates subscription of checkpointed blocks,
+// connect returns event service delivering blocks from block from
+func newCheckpointedSubscription(name string, cp Checkpointer, h CheckpointHandler,
+	connect func(from uint64) (fab.EventService, func(), error)) *Subscription {
+	var (
+		from   uint64
+		lastTx int
+	)
+
+	source := func() (fab.EventService, func(), error) {
+		last, err := cp.Load(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		from, lastTx = last.resume()
+		return connect(from)
+	}
+
+	register := func(es fab.EventService) (fab.Registration, func() error, error) {
+		reg, ch, err := es.RegisterBlockEvent()
+		if err != nil {
+			return nil, nil, err
+		}
+		return reg, func() error {
+			fail := func(err error) error {
+				log.Printf("Checkpointed subscription stopped: %v", err)
+				// the dispatcher blocks on full channel, so drain it
+				// until Unregister closes it
+				go es.Unregister(reg)
+				for range ch {
+				}
+				return err
+			}
+
+			for e := range ch {
+				n := e.Block.Header.Number
+				if n < from {
+					continue
+				}
+				p := &TxProgress{name: name, cp: cp, blockNum: n, last: -1}
+				if n == from {
+					p.last = lastTx
+				}
+
+				if err := h(e, p); err != nil {
+					return fail(errors.WithMessagef(err, "handle block %d of %s error", n, name))
+				}
+				if p.complete {
+					continue
+				}
+				if err := cp.Save(name, Checkpoint{BlockNum: n, TxIndex: p.last, Complete: true}); err != nil {
+					return fail(errors.WithMessagef(err, "save checkpoint of block %d of %s error", n, name))
+				}
+			}
+			return nil
+		}, nil
+	}
+
+	return newSubscription("checkpointed block event "+name, source, register)
+}
+
+// newDeliverClient creates an event client which is not shared with others,
+// so its seek options take effect. It connects to the peers of discovery,
+// or the peers of channel if discovery is nil. It should be closed after use.
+func (s *Subscriber) newDeliverClient(channelID string, discovery fab.DiscoveryService, opts ...options.Opt) (*deliverclient.Client, error) {
+	chCtx, err := s.sdk.ChannelContext(channelID, fabsdk.WithUser(s.user))()
+	if err != nil {
+		return nil, errors.WithMessage(err, "create channel context error")
+	}
+	chCfg, err := chCtx.ChannelService().ChannelConfig()
+	if err != nil {
+		return nil, errors.WithMessage(err, "get channel config error")
+	}
+	if discovery == nil {
+		discovery, err = chCtx.ChannelService().Discovery()
+		if err != nil {
+			return nil, errors.WithMessage(err, "get discovery service error")
+		}
+	}
+
+	dc, err := deliverclient.New(chCtx, chCfg, discovery, opts...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "create deliver client of %s error", channelID)
+	}
+	return dc, nil
+}
@@ -0,0 +1,301 @@
+package events
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// mockBlockService delivers blocks from a block number, it supports block
+// events only
+type mockBlockService struct {
+	blocks []*common.Block
+	from   uint64
+
+	mu   sync.Mutex
+	stop map[*mockReg]chan struct{}
+}
+
+type mockReg struct{}
+
+func (s *mockBlockService) RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	reg := &mockReg{}
+	stop := make(chan struct{})
+	s.mu.Lock()
+	if s.stop == nil {
+		s.stop = make(map[*mockReg]chan struct{})
+	}
+	s.stop[reg] = stop
+	s.mu.Unlock()
+
+	blocks := s.blocks[s.from:]
+	ch := make(chan *fab.BlockEvent)
+	go func() {
+		defer close(ch)
+		for _, b := range blocks {
+			select {
+			case ch <- &fab.BlockEvent{Block: b}:
+			case <-stop:
+				return
+			}
+		}
+		<-stop
+	}()
+	return reg, ch, nil
+}
+
+func (s *mockBlockService) RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.FilteredBlockEvent, error) {
+	return nil, nil, errors.New("not supported")
+}
+
+func (s *mockBlockService) RegisterChaincodeEvent(ccID, eventFilter string) (fab.Registration, <-chan *fab.CCEvent, error) {
+	return nil, nil, errors.New("not supported")
+}
+
+func (s *mockBlockService) RegisterTxStatusEvent(txID string) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
+	return nil, nil, errors.New("not supported")
+}
+
+func (s *mockBlockService) Unregister(reg fab.Registration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stop, ok := s.stop[reg.(*mockReg)]; ok {
+		close(stop)
+		delete(s.stop, reg.(*mockReg))
+	}
+}
+
+func newBlocks(n, txs int) []*common.Block {
+	var blocks []*common.Block
+	for i := 0; i < n; i++ {
+		data := &common.BlockData{}
+		for j := 0; j < txs; j++ {
+			data.Data = append(data.Data, []byte(fmt.Sprintf("tx %d of block %d", j, i)))
+		}
+		blocks = append(blocks, &common.Block{Header: &common.BlockHeader{Number: uint64(i)}, Data: data})
+	}
+	return blocks
+}
+
+var effectsBucket = []byte("effects")
+
+// crashPoint is where the handler stops as if the process crashed, before
+// or after the bolt transaction of tx is committed. Tx -1 is the
+// transaction completing the block.
+type crashPoint struct {
+	block uint64
+	tx    int
+	after bool
+}
+
+var errCrash = errors.New("crash")
+
+// countingHandler counts the effects of each tx in the bolt db of cp, and
+// saves checkpoints with effects
+func countingHandler(cp *BoltCheckpointer, crashes map[crashPoint]bool, last uint64, done chan struct{}) CheckpointHandler {
+	return func(e *fab.BlockEvent, p *TxProgress) error {
+		n := e.Block.Header.Number
+		update := func(tx int, effect func(tx *bolt.Tx) error, save func(cpTx CheckpointTx) error) error {
+			before := crashPoint{block: n, tx: tx}
+			after := crashPoint{block: n, tx: tx, after: true}
+			err := cp.Update(func(tx *bolt.Tx, cpTx CheckpointTx) error {
+				if err := effect(tx); err != nil {
+					return err
+				}
+				if err := save(cpTx); err != nil {
+					return err
+				}
+				if crashes[before] {
+					delete(crashes, before)
+					return errCrash
+				}
+				return nil
+			})
+			if err == nil && crashes[after] {
+				delete(crashes, after)
+				return errCrash
+			}
+			return err
+		}
+
+		for i := range e.Block.Data.Data {
+			if p.Processed(i) {
+				continue
+			}
+			i := i
+			err := update(i, func(tx *bolt.Tx) error {
+				return incr(tx, fmt.Sprintf("%d/%d", n, i))
+			}, func(cpTx CheckpointTx) error {
+				return p.Commit(cpTx, i)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err := update(-1, func(tx *bolt.Tx) error {
+			return incr(tx, fmt.Sprintf("%d", n))
+		}, p.Complete)
+		if err == nil && n == last {
+			close(done)
+		}
+		return err
+	}
+}
+
+func incr(tx *bolt.Tx, key string) error {
+	b, err := tx.CreateBucketIfNotExists(effectsBucket)
+	if err != nil {
+		return err
+	}
+	var n uint64
+	if v := b.Get([]byte(key)); v != nil {
+		n = binary.BigEndian.Uint64(v)
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, n+1)
+	return b.Put([]byte(key), v)
+}
+
+// failingCheckpointer fails to save checkpoint out of the transactions of
+// handler, as if the process crashed right after handler returned
+type failingCheckpointer struct {
+	*BoltCheckpointer
+}
+
+func (f failingCheckpointer) Save(name string, cp Checkpoint) error {
+	return errCrash
+}
+
+func TestCheckpointedExactlyOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "durable-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cp, err := NewBoltCheckpointer(filepath.Join(dir, "checkpoints.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+
+	const blocks, txs = 5, 3
+	crashes := map[crashPoint]bool{
+		{block: 1, tx: 1}:               true, // effects rolled back
+		{block: 2, tx: 1, after: true}:  true, // tx committed, block not
+		{block: 3, tx: -1}:              true, // block completion rolled back
+		{block: 3, tx: -1, after: true}: true, // block committed
+	}
+	done := make(chan struct{})
+	h := countingHandler(cp, crashes, blocks-1, done)
+
+	ms := &mockBlockService{blocks: newBlocks(blocks, txs)}
+	connect := func(from uint64) (fab.EventService, func(), error) {
+		ms.from = from
+		return ms, func() {}, nil
+	}
+	// the subscription never saves checkpoint itself, as handler completes
+	// each block in its transaction
+	sub := newCheckpointedSubscription("test", failingCheckpointer{cp}, h, connect)
+
+	restarts := 0
+	for finished := false; !finished; {
+		if err := sub.Start(); err != nil {
+			t.Fatalf("start error: %v", err)
+		}
+		select {
+		case <-sub.Done():
+			if errors.Cause(sub.Err()) != errCrash {
+				t.Fatalf("subscription stopped with %v, want crash", sub.Err())
+			}
+			restarts++
+		case <-done:
+			sub.Stop()
+			finished = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	if restarts != 4 || len(crashes) != 0 {
+		t.Fatalf("restarted %d times, crash points %v left", restarts, crashes)
+	}
+
+	err = cp.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(effectsBucket)
+		for n := 0; n < blocks; n++ {
+			keys := []string{fmt.Sprintf("%d", n)}
+			for i := 0; i < txs; i++ {
+				keys = append(keys, fmt.Sprintf("%d/%d", n, i))
+			}
+			for _, k := range keys {
+				v := b.Get([]byte(k))
+				if v == nil || binary.BigEndian.Uint64(v) != 1 {
+					return errors.Errorf("effect %s applied %v times, want once", k, v)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last, err := cp.Load("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *last != (Checkpoint{BlockNum: blocks - 1, TxIndex: txs - 1, Complete: true}) {
+		t.Fatalf("got checkpoint %+v", last)
+	}
+}
+
+func TestCheckpointedSavesIncompleteBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "durable-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cp, err := NewFileCheckpointer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// handler without Complete is checkpointed by the subscription
+	handled := make(chan uint64, 10)
+	h := func(e *fab.BlockEvent, p *TxProgress) error {
+		handled <- e.Block.Header.Number
+		return nil
+	}
+	ms := &mockBlockService{blocks: newBlocks(3, 1)}
+	sub := newCheckpointedSubscription("test", cp, h, func(from uint64) (fab.EventService, func(), error) {
+		ms.from = from
+		return ms, func() {}, nil
+	})
+	if err := sub.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 3; i++ {
+		if n := <-handled; n != i {
+			t.Fatalf("handled block %d, want %d", n, i)
+		}
+	}
+	sub.Stop()
+
+	last, err := cp.Load("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.BlockNum != 2 || !last.Complete {
+		t.Fatalf("got checkpoint %+v, want complete block 2", last)
+	}
+}
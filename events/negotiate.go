@@ -0,0 +1,282 @@
+package events
+
+import (
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	eventclient "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/client"
+	clientdispatcher "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/client/dispatcher"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// DeliveryMode is the kind of blocks delivered by peer
+type DeliveryMode int32
+
+const (
+	// Unnegotiated means the subscription is not started
+	Unnegotiated DeliveryMode = iota
+	// FullBlocks delivers blocks with transaction details
+	FullBlocks
+	// FilteredBlocks delivers transaction IDs, validation codes and
+	// chaincode event names only
+	FilteredBlocks
+)
+
+func (m DeliveryMode) String() string {
+	switch m {
+	case Unnegotiated:
+		return "Unnegotiated"
+	case FullBlocks:
+		return "FullBlocks"
+	case FilteredBlocks:
+		return "FilteredBlocks"
+	}
+	return "Unknown"
+}
+
+// UnifiedBlockEvent is a block event of either mode. Block is nil in
+// FilteredBlocks mode.
+type UnifiedBlockEvent struct {
+	Mode         DeliveryMode
+	Number       uint64
+	SourceURL    string
+	Block        *common.Block
+	Transactions []*UnifiedTx
+}
+
+// UnifiedTx is a transaction of UnifiedBlockEvent. Decoded is nil in
+// FilteredBlocks mode, and chaincode events have no payload.
+type UnifiedTx struct {
+	Index           int
+	TxID            string
+	Type            common.HeaderType
+	ValidationCode  pb.TxValidationCode
+	ChaincodeEvents []*pb.ChaincodeEvent
+	Decoded         *Transaction
+}
+
+// UnifiedBlockHandler handles unified block events
+type UnifiedBlockHandler func(e *UnifiedBlockEvent)
+
+// NegotiatedSubscription is a block subscription whose mode is negotiated
+// at each start
+type NegotiatedSubscription struct {
+	*Subscription
+	mode int32
+}
+
+// Mode returns the mode negotiated at the last start
+func (n *NegotiatedSubscription) Mode() DeliveryMode {
+	return DeliveryMode(atomic.LoadInt32(&n.mode))
+}
+
+// negotiateTimeout is how long to wait for the deliver service to accept
+// or deny full blocks
+const negotiateTimeout = 5 * time.Second
+
+// SubscribeNegotiated subscribes blocks of channel, full blocks are
+// requested first, and if the identity is denied to access them, or the
+// access is not confirmed in time, filtered blocks are delivered instead.
+func (s *Subscriber) SubscribeNegotiated(channelID string, h UnifiedBlockHandler) (*NegotiatedSubscription, error) {
+	full := func() (fab.EventService, func(), error) {
+		dc, err := s.negotiate(channelID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dc, dc.Close, nil
+	}
+	filtered := func() (fab.EventService, func(), error) {
+		dc, err := s.newDeliverClient(channelID, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dc, dc.Close, nil
+	}
+	n := newNegotiatedSubscription("negotiated block event of "+channelID, h, full, filtered)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, n.Subscription)
+	return n, nil
+}
+
+// newNegotiatedSubscription creates subscription which connects by full
+// first, and by filtered if full blocks are denied or not confirmed
+func newNegotiatedSubscription(name string, h UnifiedBlockHandler,
+	full, filtered func() (fab.EventService, func(), error)) *NegotiatedSubscription {
+	n := &NegotiatedSubscription{}
+
+	source := func() (fab.EventService, func(), error) {
+		es, closer, err := full()
+		if err == nil {
+			atomic.StoreInt32(&n.mode, int32(FullBlocks))
+			return es, closer, nil
+		}
+		if cause := errors.Cause(err); cause != errAccessDenied && cause != errNegotiateTimeout {
+			return nil, nil, err
+		}
+
+		log.Printf("Full blocks of %s: %v, fallback to filtered blocks", name, err)
+		es, closer, err = filtered()
+		if err != nil {
+			return nil, nil, err
+		}
+		atomic.StoreInt32(&n.mode, int32(FilteredBlocks))
+		return es, closer, nil
+	}
+
+	register := func(es fab.EventService) (fab.Registration, func() error, error) {
+		if n.Mode() == FullBlocks {
+			reg, ch, err := es.RegisterBlockEvent()
+			if err != nil {
+				return nil, nil, err
+			}
+			return reg, func() error {
+				for e := range ch {
+					h(unifyBlock(e))
+				}
+				return nil
+			}, nil
+		}
+
+		reg, ch, err := es.RegisterFilteredBlockEvent()
+		if err != nil {
+			return nil, nil, err
+		}
+		return reg, func() error {
+			for e := range ch {
+				h(unifyFilteredBlock(e))
+			}
+			return nil
+		}, nil
+	}
+
+	n.Subscription = newSubscription(name, source, register)
+	return n
+}
+
+var (
+	errAccessDenied     = errors.New("access denied")
+	errNegotiateTimeout = errors.New("access is not confirmed in time")
+)
+
+// negotiate connects for full blocks, and waits until the newest block is
+// received, or the deliver service denies with a fatal disconnection, which
+// is only caused by FORBIDDEN status. Full blocks are not assumed permitted
+// if neither comes before timeout.
+func (s *Subscriber) negotiate(channelID string) (*deliverclient.Client, error) {
+	connCh := make(chan *clientdispatcher.ConnectionEvent, 1)
+	denied := make(chan struct{})
+	failed := make(chan struct{})
+	// the client sends connection events without buffer, drain them until
+	// it is closed
+	go func() {
+		for {
+			select {
+			case e, ok := <-connCh:
+				if !ok {
+					return
+				}
+				if !e.Connected && e.Err != nil && e.Err.IsFatal() {
+					select {
+					case <-denied:
+					default:
+						close(denied)
+					}
+				}
+			case <-failed:
+				return
+			}
+		}
+	}()
+
+	dc, err := s.newDeliverClient(channelID, nil,
+		eventclient.WithBlockEvents(),
+		eventclient.WithConnectionEvent(connCh))
+	if err != nil {
+		close(failed)
+		return nil, err
+	}
+
+	timeout := time.NewTimer(negotiateTimeout)
+	defer timeout.Stop()
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-denied:
+			dc.Close()
+			return nil, errAccessDenied
+		case <-tick.C:
+			// the newest block is received, so full blocks are permitted
+			if dc.Dispatcher().LastBlockNum() != math.MaxUint64 {
+				return dc, nil
+			}
+		case <-timeout.C:
+			dc.Close()
+			return nil, errNegotiateTimeout
+		}
+	}
+}
+
+func unifyBlock(e *fab.BlockEvent) *UnifiedBlockEvent {
+	u := &UnifiedBlockEvent{
+		Mode:      FullBlocks,
+		Number:    e.Block.Header.Number,
+		SourceURL: e.SourceURL,
+		Block:     e.Block,
+	}
+
+	b, err := DecodeBlock(e.Block)
+	if err != nil {
+		log.Printf("Decode block %d error: %v", u.Number, err)
+		return u
+	}
+	for _, tx := range b.Transactions {
+		ut := &UnifiedTx{
+			Index:          tx.Index,
+			TxID:           tx.TxID,
+			Type:           tx.Type,
+			ValidationCode: tx.ValidationCode,
+			Decoded:        tx,
+		}
+		for _, a := range tx.Actions {
+			if a.Event != nil {
+				ut.ChaincodeEvents = append(ut.ChaincodeEvents, a.Event)
+			}
+		}
+		u.Transactions = append(u.Transactions, ut)
+	}
+	return u
+}
+
+func unifyFilteredBlock(e *fab.FilteredBlockEvent) *UnifiedBlockEvent {
+	u := &UnifiedBlockEvent{
+		Mode:      FilteredBlocks,
+		Number:    e.FilteredBlock.Number,
+		SourceURL: e.SourceURL,
+	}
+	for i, tx := range e.FilteredBlock.FilteredTransactions {
+		ut := &UnifiedTx{
+			Index:          i,
+			TxID:           tx.Txid,
+			Type:           tx.Type,
+			ValidationCode: tx.TxValidationCode,
+		}
+		if actions := tx.GetTransactionActions(); actions != nil {
+			for _, a := range actions.ChaincodeActions {
+				if a.ChaincodeEvent != nil {
+					ut.ChaincodeEvents = append(ut.ChaincodeEvents, a.ChaincodeEvent)
+				}
+			}
+		}
+		u.Transactions = append(u.Transactions, ut)
+	}
+	return u
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// mockFilteredService delivers its blocks as filtered blocks too
+type mockFilteredService struct {
+	mockBlockService
+}
+
+func (s *mockFilteredService) RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.FilteredBlockEvent, error) {
+	reg, blocks, err := s.RegisterBlockEvent()
+	if err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan *fab.FilteredBlockEvent)
+	go func() {
+		defer close(ch)
+		for e := range blocks {
+			ch <- &fab.FilteredBlockEvent{FilteredBlock: &pb.FilteredBlock{Number: e.Block.Header.Number}}
+		}
+	}()
+	return reg, ch, nil
+}
+
+func TestNegotiateFallback(t *testing.T) {
+	errOther := errors.New("connection refused")
+	tests := []struct {
+		name     string
+		fullErr  error
+		wantMode DeliveryMode
+		wantErr  error
+	}{
+		{"permitted", nil, FullBlocks, nil},
+		{"denied", errAccessDenied, FilteredBlocks, nil},
+		{"timeout", errors.WithMessage(errNegotiateTimeout, "negotiate error"), FilteredBlocks, nil},
+		{"other error", errOther, Unnegotiated, errOther},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ms := &mockFilteredService{mockBlockService{blocks: newBlocks(2, 0)}}
+			full := func() (fab.EventService, func(), error) {
+				if test.fullErr != nil {
+					return nil, nil, test.fullErr
+				}
+				return ms, func() {}, nil
+			}
+			filtered := func() (fab.EventService, func(), error) {
+				return ms, func() {}, nil
+			}
+
+			handled := make(chan *UnifiedBlockEvent, 2)
+			n := newNegotiatedSubscription("test", func(e *UnifiedBlockEvent) {
+				handled <- e
+			}, full, filtered)
+			err := n.Start()
+			if errors.Cause(err) != test.wantErr {
+				t.Fatalf("got start error %v, want %v", err, test.wantErr)
+			}
+			if n.Mode() != test.wantMode {
+				t.Fatalf("got mode %v, want %v", n.Mode(), test.wantMode)
+			}
+			if err != nil {
+				return
+			}
+			defer n.Stop()
+
+			for i := uint64(0); i < 2; i++ {
+				select {
+				case e := <-handled:
+					if e.Mode != test.wantMode || e.Number != i {
+						t.Fatalf("got event %+v, want block %d of %v", e, i, test.wantMode)
+					}
+					if (e.Block != nil) != (test.wantMode == FullBlocks) {
+						t.Fatalf("got block %v in %v mode", e.Block, e.Mode)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("timeout")
+				}
+			}
+		})
+	}
+}
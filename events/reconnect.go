@@ -0,0 +1,436 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	eventclient "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/client"
+	clientdispatcher "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/client/dispatcher"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient/seek"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/dispatcher"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// ConnectionState is the state of the connection of a resilient subscription
+type ConnectionState int
+
+const (
+	// Connecting means connecting to Peer
+	Connecting ConnectionState = iota
+	// Connected means connected to Peer, followed by Backfilling or Live
+	Connected
+	// Backfilling means delivering the blocks from FromBlock to ToBlock,
+	// which were committed while disconnected
+	Backfilling
+	// Live means delivering new blocks
+	Live
+	// Disconnected means the connection to Peer failed or dropped, Err is
+	// the reason if known
+	Disconnected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Connecting:
+		return "Connecting"
+	case Connected:
+		return "Connected"
+	case Backfilling:
+		return "Backfilling"
+	case Live:
+		return "Live"
+	case Disconnected:
+		return "Disconnected"
+	}
+	return "Unknown"
+}
+
+// ConnectionEvent reports the change of connection state
+type ConnectionEvent struct {
+	State     ConnectionState
+	Peer      string
+	Err       error
+	FromBlock uint64
+	ToBlock   uint64
+	Time      time.Time
+}
+
+// ConnectionHandler handles connection events
+type ConnectionHandler func(e *ConnectionEvent)
+
+type reconnectOptions struct {
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	factor       float64
+	startBlock   *uint64
+	filter       fab.BlockFilter
+}
+
+// ReconnectOption configures resilient subscription
+type ReconnectOption func(o *reconnectOptions)
+
+// WithBackoff sets the delay before reconnecting, the delay starts from
+// initial, and is multiplied by factor after each failed connection, up to
+// max. It is reset after connected.
+func WithBackoff(initial, max time.Duration, factor float64) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.initialDelay = initial
+		o.maxDelay = max
+		o.factor = factor
+	}
+}
+
+// WithStartBlock delivers blocks from block n, instead of the newest block
+func WithStartBlock(n uint64) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.startBlock = &n
+	}
+}
+
+// WithBlockFilter delivers only the blocks accepted by filter
+func WithBlockFilter(filter fab.BlockFilter) ReconnectOption {
+	return func(o *reconnectOptions) {
+		o.filter = filter
+	}
+}
+
+// SubscribeResilient subscribes block events of channel, and keeps the
+// subscription alive across connection failures: when the connection
+// drops, it reconnects to the next event source peer with backoff, and
+// delivers the blocks missed while disconnected before new blocks. Each
+// block is delivered once and in order. states is notified of connection
+// state changes, it can be nil.
+func (s *Subscriber) SubscribeResilient(channelID string, h BlockHandler, states ConnectionHandler, opts ...ReconnectOption) (*Subscription, error) {
+	o := reconnectOptions{
+		initialDelay: time.Second,
+		maxDelay:     time.Minute,
+		factor:       2,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.initialDelay <= 0 || o.maxDelay < o.initialDelay || o.factor < 1 {
+		return nil, errors.Errorf("invalid backoff: initial %v, max %v, factor %v",
+			o.initialDelay, o.maxDelay, o.factor)
+	}
+
+	// the block to deliver next is kept across restarts of subscription
+	pos := &blockPosition{}
+	if o.startBlock != nil {
+		pos.set(*o.startBlock)
+	}
+
+	source := func() (fab.EventService, func(), error) {
+		rs := &resilientService{
+			s:         s,
+			channelID: channelID,
+			opts:      o,
+			states:    states,
+			pos:       pos,
+			stop:      make(chan struct{}),
+			done:      make(chan struct{}),
+		}
+		return rs, func() {}, nil
+	}
+
+	register := func(es fab.EventService) (fab.Registration, func() error, error) {
+		reg, ch, err := es.RegisterBlockEvent()
+		if err != nil {
+			return nil, nil, err
+		}
+		return reg, func() error {
+			for e := range ch {
+				h(e)
+			}
+			return nil
+		}, nil
+	}
+
+	sub := newSubscription("resilient block event of "+channelID, source, register)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, sub)
+	return sub, nil
+}
+
+// blockPosition is the number of the block to deliver next
+type blockPosition struct {
+	mu    sync.Mutex
+	next  uint64
+	known bool
+}
+
+func (p *blockPosition) get() (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.next, p.known
+}
+
+func (p *blockPosition) set(n uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next, p.known = n, true
+}
+
+// resilientService is an event service that only supports block events,
+// it connects event source peers one by one until stopped
+type resilientService struct {
+	s         *Subscriber
+	channelID string
+	opts      reconnectOptions
+	states    ConnectionHandler
+	pos       *blockPosition
+	filters   []fab.BlockFilter
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+var errBlockEventsOnly = errors.New("resilient subscription supports block events only")
+
+// RegisterBlockEvent starts connecting, blocks are delivered if they are
+// accepted by filter and the filter of WithBlockFilter
+func (r *resilientService) RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	if r.opts.filter != nil {
+		r.filters = append(r.filters, r.opts.filter)
+	}
+	r.filters = append(r.filters, filter...)
+
+	out := make(chan *fab.BlockEvent)
+	go r.run(out)
+	return r, out, nil
+}
+
+func (r *resilientService) RegisterFilteredBlockEvent() (fab.Registration, <-chan *fab.FilteredBlockEvent, error) {
+	return nil, nil, errBlockEventsOnly
+}
+
+func (r *resilientService) RegisterChaincodeEvent(ccID, eventFilter string) (fab.Registration, <-chan *fab.CCEvent, error) {
+	return nil, nil, errBlockEventsOnly
+}
+
+func (r *resilientService) RegisterTxStatusEvent(txID string) (fab.Registration, <-chan *fab.TxStatusEvent, error) {
+	return nil, nil, errBlockEventsOnly
+}
+
+// Unregister stops connecting, and waits the event channel to be closed
+func (r *resilientService) Unregister(reg fab.Registration) {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+func (r *resilientService) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *resilientService) emit(e ConnectionEvent) {
+	e.Time = time.Now()
+	if e.Err != nil {
+		log.Printf("Block event connection of %s %v: %s: %v", r.channelID, e.State, e.Peer, e.Err)
+	}
+	if r.states != nil {
+		r.states(&e)
+	}
+}
+
+// run connects peers in turn until stopped, out is closed when it returns
+func (r *resilientService) run(out chan<- *fab.BlockEvent) {
+	defer close(r.done)
+	defer close(out)
+
+	delay := r.opts.initialDelay
+	for i := 0; ; i++ {
+		peers, err := r.eventSources()
+		if err != nil {
+			r.emit(ConnectionEvent{State: Disconnected, Err: err})
+		} else {
+			peer := peers[i%len(peers)]
+			connected, err := r.serve(peer, out)
+			if r.stopped() {
+				return
+			}
+			if connected {
+				delay = r.opts.initialDelay
+			}
+			r.emit(ConnectionEvent{State: Disconnected, Peer: peer.URL(), Err: err})
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = time.Duration(float64(delay) * r.opts.factor)
+		if delay > r.opts.maxDelay {
+			delay = r.opts.maxDelay
+		}
+	}
+}
+
+// serve delivers blocks from peer until the connection drops or stopped,
+// it reports whether the connection was established
+func (r *resilientService) serve(peer fab.Peer, out chan<- *fab.BlockEvent) (bool, error) {
+	r.emit(ConnectionEvent{State: Connecting, Peer: peer.URL()})
+
+	height, err := r.height(peer)
+	if err != nil {
+		return false, err
+	}
+	next, known := r.pos.get()
+	if !known {
+		// start from the newest block, like seek.Newest
+		if height > 0 {
+			next = height - 1
+		}
+		r.pos.set(next)
+	}
+
+	// the client sends connection events without buffer, drain them until
+	// it is closed, and pass the disconnect reason to the loop
+	connCh := make(chan *clientdispatcher.ConnectionEvent, 1)
+	disconnected := make(chan error, 1)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			select {
+			case e, ok := <-connCh:
+				if !ok {
+					return
+				}
+				if !e.Connected {
+					select {
+					case disconnected <- e.Err:
+					default:
+					}
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	dc, err := r.s.newDeliverClient(r.channelID, staticDiscovery{peer},
+		eventclient.WithBlockEvents(),
+		eventclient.WithReconnect(false),
+		eventclient.WithConnectionEvent(connCh),
+		deliverclient.WithSeekType(seek.FromBlock),
+		deliverclient.WithBlockNum(next),
+		// block the dispatcher instead of dropping events for slow handler
+		dispatcher.WithEventConsumerTimeout(0))
+	if err != nil {
+		return false, err
+	}
+	defer dc.Close()
+
+	_, ch, err := dc.RegisterBlockEvent()
+	if err != nil {
+		return false, errors.WithMessage(err, "register block event error")
+	}
+
+	r.emit(ConnectionEvent{State: Connected, Peer: peer.URL()})
+	// blocks committed while disconnected are backfilled, the first
+	// connection starts from the newest block, which is not a backfill
+	backfilling := known && next < height
+	if backfilling {
+		r.emit(ConnectionEvent{State: Backfilling, Peer: peer.URL(), FromBlock: next, ToBlock: height - 1})
+	} else {
+		r.emit(ConnectionEvent{State: Live, Peer: peer.URL(), FromBlock: next})
+	}
+
+	for {
+		select {
+		case <-r.stop:
+			return true, nil
+		case err := <-disconnected:
+			return true, err
+		case e, ok := <-ch:
+			if !ok {
+				return true, errors.New("event channel closed")
+			}
+
+			n := e.Block.Header.Number
+			if n < next {
+				continue
+			}
+			next = n + 1
+			if r.accept(e.Block) {
+				out <- e
+			}
+			r.pos.set(next)
+
+			if backfilling && next >= height {
+				backfilling = false
+				r.emit(ConnectionEvent{State: Live, Peer: peer.URL(), FromBlock: next})
+			}
+		}
+	}
+}
+
+func (r *resilientService) accept(b *common.Block) bool {
+	for _, filter := range r.filters {
+		if filter != nil && !filter(b) {
+			return false
+		}
+	}
+	return true
+}
+
+// height queries the ledger height of peer
+func (r *resilientService) height(peer fab.Peer) (uint64, error) {
+	lc, err := ledger.New(r.s.sdk.ChannelContext(r.channelID, fabsdk.WithUser(r.s.user)))
+	if err != nil {
+		return 0, errors.WithMessage(err, "create ledger client error")
+	}
+	info, err := lc.QueryInfo(ledger.WithTargets(peer))
+	if err != nil {
+		return 0, errors.WithMessage(err, "query ledger height error")
+	}
+	return info.BCI.Height, nil
+}
+
+// eventSources creates the event source peers of channel in connection
+// profile
+func (r *resilientService) eventSources() ([]fab.Peer, error) {
+	chCtx, err := r.s.sdk.ChannelContext(r.channelID, fabsdk.WithUser(r.s.user))()
+	if err != nil {
+		return nil, errors.WithMessage(err, "create channel context error")
+	}
+
+	var peers []fab.Peer
+	for _, cp := range chCtx.EndpointConfig().ChannelPeers(r.channelID) {
+		if !cp.EventSource {
+			continue
+		}
+		cp := cp
+		peer, err := chCtx.InfraProvider().CreatePeerFromConfig(&cp.NetworkPeer)
+		if err != nil {
+			return nil, errors.WithMessage(err, "creating peer from config failed")
+		}
+		peers = append(peers, peer)
+	}
+	if len(peers) == 0 {
+		return nil, errors.Errorf("no event source peer of %s", r.channelID)
+	}
+	return peers, nil
+}
+
+// staticDiscovery discovers the given peers only
+type staticDiscovery []fab.Peer
+
+func (d staticDiscovery) GetPeers() ([]fab.Peer, error) {
+	return d, nil
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// ReplayHandlers are the handlers of replayed blocks, nil handler is
+// skipped. Chaincode receives the events of valid transactions, as the
+// event service does, so handlers of live events can be reused, e.g.
+// Router.Dispatch.
+type ReplayHandlers struct {
+	Block     BlockHandler
+	Chaincode ChaincodeHandler
+}
+
+// Replay fetches blocks fromBlock to toBlock of channel from ledger, and
+// passes them to handlers in order. toBlock is limited to the last block
+// of ledger. Blocks are fetched by workers in parallel.
+func (s *Subscriber) Replay(channelID string, fromBlock, toBlock uint64, h ReplayHandlers, workers int) error {
+	if fromBlock > toBlock {
+		return errors.Errorf("invalid block range [%d, %d]", fromBlock, toBlock)
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	lc, err := ledger.New(s.sdk.ChannelContext(channelID, fabsdk.WithUser(s.user)))
+	if err != nil {
+		return errors.WithMessage(err, "create ledger client error")
+	}
+	info, err := lc.QueryInfo()
+	if err != nil {
+		return errors.WithMessage(err, "query ledger height error")
+	}
+	if fromBlock >= info.BCI.Height {
+		return errors.Errorf("block %d is beyond ledger height %d", fromBlock, info.BCI.Height)
+	}
+	if toBlock >= info.BCI.Height {
+		toBlock = info.BCI.Height - 1
+	}
+
+	type fetched struct {
+		num   uint64
+		block *common.Block
+		err   error
+	}
+
+	// window limits the fetched blocks waiting for delivery, it's released
+	// when a block is delivered
+	window := make(chan struct{}, workers*2)
+	jobs := make(chan uint64)
+	results := make(chan fetched)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer close(jobs)
+		for n := fromBlock; n <= toBlock; n++ {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case jobs <- n:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for n := range jobs {
+				b, err := lc.QueryBlock(n)
+				select {
+				case results <- fetched{num: n, block: b, err: err}:
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	pending := make(map[uint64]*common.Block)
+	for next := fromBlock; next <= toBlock; {
+		r := <-results
+		if r.err != nil {
+			return errors.WithMessagef(r.err, "query block %d error", r.num)
+		}
+		pending[r.num] = r.block
+
+		for b, ok := pending[next]; ok; b, ok = pending[next] {
+			delete(pending, next)
+			if err := h.deliver(b); err != nil {
+				return err
+			}
+			<-window
+			next++
+			if next > toBlock {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (h ReplayHandlers) deliver(b *common.Block) error {
+	if h.Block != nil {
+		h.Block(&fab.BlockEvent{Block: b})
+	}
+	if h.Chaincode == nil {
+		return nil
+	}
+
+	block, err := DecodeBlock(b)
+	if err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		if !tx.Valid() {
+			continue
+		}
+		for _, a := range tx.Actions {
+			if a.Event == nil || a.Event.EventName == "" {
+				continue
+			}
+			h.Chaincode(&fab.CCEvent{
+				TxID:        tx.TxID,
+				ChaincodeID: a.Event.ChaincodeId,
+				EventName:   a.Event.EventName,
+				Payload:     a.Event.Payload,
+				BlockNumber: block.Number,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package events
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// PayloadDecoder decodes the payload of chaincode event
+type PayloadDecoder func(payload []byte) (interface{}, error)
+
+// RawPayload returns the payload as it is
+func RawPayload(payload []byte) (interface{}, error) {
+	return payload, nil
+}
+
+// JSONPayload decodes json payload into a new value of the type of v, the
+// decoded value is a pointer, e.g. JSONPayload(Transfer{}) decodes into
+// *Transfer. The decoder fails every payload if v is nil.
+func JSONPayload(v interface{}) PayloadDecoder {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return invalidPayload("JSONPayload of nil")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return func(payload []byte) (interface{}, error) {
+		pv := reflect.New(t).Interface()
+		if err := json.Unmarshal(payload, pv); err != nil {
+			return nil, errors.WithMessagef(err, "unmarshal payload into %v error", t)
+		}
+		return pv, nil
+	}
+}
+
+// ProtoPayload decodes protobuf payload into a new message of the type of m,
+// the decoder fails every payload if m is nil
+func ProtoPayload(m proto.Message) PayloadDecoder {
+	if m == nil {
+		return invalidPayload("ProtoPayload of nil")
+	}
+	t := reflect.TypeOf(m).Elem()
+	return func(payload []byte) (interface{}, error) {
+		pm := reflect.New(t).Interface().(proto.Message)
+		if err := proto.Unmarshal(payload, pm); err != nil {
+			return nil, errors.WithMessagef(err, "unmarshal payload into %v error", t)
+		}
+		return pm, nil
+	}
+}
+
+// invalidPayload is the decoder of invalid type, it fails every payload
+func invalidPayload(msg string) PayloadDecoder {
+	return func(payload []byte) (interface{}, error) {
+		return nil, errors.New(msg)
+	}
+}
+
+// RouteHandler handles chaincode event with the decoded payload
+type RouteHandler func(e *fab.CCEvent, payload interface{}) error
+
+// RouteErrorHandler is called when decoding fails, or handler returns error
+// or panics
+type RouteErrorHandler func(e *fab.CCEvent, err error)
+
+type route struct {
+	ccID    string
+	pattern *regexp.Regexp
+	decode  PayloadDecoder
+	h       RouteHandler
+}
+
+// Router dispatches chaincode events to the handlers whose chaincode ID and
+// event name pattern match. Handlers of an event run concurrently, and an
+// error or panic of one handler does not affect others.
+type Router struct {
+	mu      sync.RWMutex
+	routes  []*route
+	onError RouteErrorHandler
+}
+
+// NewRouter creates router, errors of handlers are logged by default
+func NewRouter() *Router {
+	return &Router{
+		onError: func(e *fab.CCEvent, err error) {
+			log.Printf("Handle chaincode event %s/%s of tx %s error: %v", e.ChaincodeID, e.EventName, e.TxID, err)
+		},
+	}
+}
+
+// Handle routes events of chaincode ccID, whose name fully matches regular
+// expression pattern, to h. Payload is decoded by decode, RawPayload is
+// used if decode is nil.
+func (r *Router) Handle(ccID, pattern string, decode PayloadDecoder, h RouteHandler) error {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return errors.WithMessagef(err, "compile event name pattern %s error", pattern)
+	}
+	if decode == nil {
+		decode = RawPayload
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, &route{ccID: ccID, pattern: re, decode: decode, h: h})
+	return nil
+}
+
+// OnError sets the handler of errors
+func (r *Router) OnError(h RouteErrorHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onError = h
+}
+
+// ChaincodeIDs returns the chaincodes which have routes
+func (r *Router) ChaincodeIDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, rt := range r.routes {
+		if !seen[rt.ccID] {
+			seen[rt.ccID] = true
+			ids = append(ids, rt.ccID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Dispatch runs the matched handlers of e concurrently, and returns after
+// all of them returned, so events are handled in order.
+func (r *Router) Dispatch(e *fab.CCEvent) {
+	r.mu.RLock()
+	var matched []*route
+	for _, rt := range r.routes {
+		if rt.ccID == e.ChaincodeID && rt.pattern.MatchString(e.EventName) {
+			matched = append(matched, rt)
+		}
+	}
+	onError := r.onError
+	r.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, rt := range matched {
+		wg.Add(1)
+		go func(rt *route) {
+			defer wg.Done()
+			if err := rt.handle(e); err != nil && onError != nil {
+				onError(e, err)
+			}
+		}(rt)
+	}
+	wg.Wait()
+}
+
+// handle decodes payload and calls handler, panic is recovered as error
+func (rt *route) handle(e *fab.CCEvent) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.Errorf("handler panic: %v", p)
+		}
+	}()
+
+	v, err := rt.decode(e.Payload)
+	if err != nil {
+		return err
+	}
+	return rt.h(e, v)
+}
+
+// SubscribeRouter subscribes events of the chaincodes routed by r, and
+// dispatches them by r. Routes of other chaincodes added later are not
+// subscribed.
+func (s *Subscriber) SubscribeRouter(channelID string, r *Router) ([]*Subscription, error) {
+	ids := r.ChaincodeIDs()
+	if len(ids) == 0 {
+		return nil, errors.New("router has no route")
+	}
+
+	var subs []*Subscription
+	for _, ccID := range ids {
+		sub, err := s.SubscribeChaincode(channelID, ccID, ".*", r.Dispatch)
+		if err != nil {
+			for _, sub := range subs {
+				s.Remove(sub)
+			}
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
@@ -0,0 +1,222 @@
+package events
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// Kinds of record
+const (
+	RecordBlock     = "block"
+	RecordTx        = "tx"
+	RecordChaincode = "chaincode"
+)
+
+// Record is an event forwarded to sinks, fields not related to the kind
+// are empty. TxIndex is nil if the index of transaction is unknown, as
+// in records of tx status and chaincode events, and Timestamp is nil if
+// the transaction has no timestamp.
+type Record struct {
+	Kind      string `json:"kind"`
+	ChannelID string `json:"channelId,omitempty"`
+	BlockNum  uint64 `json:"blockNum"`
+
+	// block
+	DataHash     string `json:"dataHash,omitempty"`
+	PreviousHash string `json:"previousHash,omitempty"`
+	TxCount      int    `json:"txCount,omitempty"`
+
+	// tx and chaincode
+	TxIndex        *int       `json:"txIndex,omitempty"`
+	TxID           string     `json:"txId,omitempty"`
+	Timestamp      *time.Time `json:"timestamp,omitempty"`
+	ValidationCode string     `json:"validationCode,omitempty"`
+	Creator        string     `json:"creator,omitempty"`
+	ChaincodeID    string     `json:"chaincodeId,omitempty"`
+	Function       string     `json:"function,omitempty"`
+	Args           []string   `json:"args,omitempty"`
+
+	// chaincode
+	EventName string `json:"eventName,omitempty"`
+	Payload   []byte `json:"payload,omitempty"`
+}
+
+// Key identifies the event of record, it's same for the redelivered record
+func (r *Record) Key() string {
+	switch r.Kind {
+	case RecordTx:
+		return r.TxID
+	case RecordChaincode:
+		return r.TxID + "/" + r.EventName
+	}
+	return r.ChannelID + "/" + strconv.FormatUint(r.BlockNum, 10)
+}
+
+// Sink receives records. Send returns nil only if records are delivered,
+// records may be sent again if the process restarts before checkpoint, so
+// receivers should dedupe by Key.
+type Sink interface {
+	Send(records []*Record) error
+	Close() error
+}
+
+// MultiSink sends records to all sinks, it fails if any sink fails
+type MultiSink []Sink
+
+// Send sends records to each sink in order
+func (m MultiSink) Send(records []*Record) error {
+	for _, s := range m {
+		if err := s.Send(records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all sinks, and returns the first error
+func (m MultiSink) Close() error {
+	var first error
+	for _, s := range m {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// BlockRecord creates the record of block
+func BlockRecord(channelID string, b *Block) *Record {
+	return &Record{
+		Kind:         RecordBlock,
+		ChannelID:    channelID,
+		BlockNum:     b.Number,
+		DataHash:     hex.EncodeToString(b.DataHash),
+		PreviousHash: hex.EncodeToString(b.PreviousHash),
+		TxCount:      len(b.Transactions),
+	}
+}
+
+// TxRecords creates the records of transaction, a tx record, followed by
+// a chaincode record for each chaincode event
+func TxRecords(channelID string, blockNum uint64, tx *Transaction) []*Record {
+	var ts *time.Time
+	if !tx.Timestamp.IsZero() {
+		t := tx.Timestamp
+		ts = &t
+	}
+	index := tx.Index
+
+	r := &Record{
+		Kind:           RecordTx,
+		ChannelID:      channelID,
+		BlockNum:       blockNum,
+		TxIndex:        &index,
+		TxID:           tx.TxID,
+		Timestamp:      ts,
+		ValidationCode: tx.ValidationCode.String(),
+		Creator:        tx.Creator.MSPID,
+	}
+	records := []*Record{r}
+
+	for i, a := range tx.Actions {
+		if i == 0 {
+			r.ChaincodeID = a.ChaincodeID
+			r.Function = a.Function
+			for _, arg := range a.Args {
+				r.Args = append(r.Args, string(arg))
+			}
+		}
+		// events of invalid transactions are not emitted by peer
+		if a.Event != nil && a.Event.EventName != "" && tx.Valid() {
+			records = append(records, &Record{
+				Kind:        RecordChaincode,
+				ChannelID:   channelID,
+				BlockNum:    blockNum,
+				TxIndex:     &index,
+				TxID:        tx.TxID,
+				Timestamp:   ts,
+				ChaincodeID: a.Event.ChaincodeId,
+				EventName:   a.Event.EventName,
+				Payload:     a.Event.Payload,
+			})
+		}
+	}
+	return records
+}
+
+// TxStatusRecord creates the record of tx status event
+func TxStatusRecord(channelID string, e *fab.TxStatusEvent) *Record {
+	return &Record{
+		Kind:           RecordTx,
+		ChannelID:      channelID,
+		BlockNum:       e.BlockNumber,
+		TxID:           e.TxID,
+		ValidationCode: e.TxValidationCode.String(),
+	}
+}
+
+// ChaincodeRecord creates the record of chaincode event
+func ChaincodeRecord(channelID string, e *fab.CCEvent) *Record {
+	return &Record{
+		Kind:        RecordChaincode,
+		ChannelID:   channelID,
+		BlockNum:    e.BlockNumber,
+		TxID:        e.TxID,
+		ChaincodeID: e.ChaincodeID,
+		EventName:   e.EventName,
+		Payload:     e.Payload,
+	}
+}
+
+// SinkHandler forwards the records of each block to sink, use it with
+// SubscribeCheckpointed for at-least-once delivery: each transaction is
+// checkpointed after its records are sent, and the block record is sent
+// after all transactions, so nothing is lost if the process restarts.
+func SinkHandler(channelID string, sink Sink) CheckpointHandler {
+	return func(e *fab.BlockEvent, p *TxProgress) error {
+		b, err := DecodeBlock(e.Block)
+		if err != nil {
+			return err
+		}
+
+		for _, tx := range b.Transactions {
+			if p.Processed(tx.Index) {
+				continue
+			}
+			if err := sink.Send(TxRecords(channelID, b.Number, tx)); err != nil {
+				return errors.WithMessagef(err, "send records of tx %s error", tx.TxID)
+			}
+			// sinks are not transactional, so it's at-least-once
+			if err := p.Commit(nil, tx.Index); err != nil {
+				return err
+			}
+		}
+
+		if err := sink.Send([]*Record{BlockRecord(channelID, b)}); err != nil {
+			return errors.WithMessagef(err, "send record of block %d error", b.Number)
+		}
+		return nil
+	}
+}
+
+// retry calls f until it succeeds, fails with a permanent error, or
+// attempts are used up. The delay doubles after each attempt.
+func retry(attempts int, delay time.Duration, f func() (retryable bool, err error)) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var retryable bool
+		if retryable, err = f(); err == nil || !retryable {
+			return err
+		}
+	}
+	return errors.WithMessagef(err, "failed after %d attempts", attempts)
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileSink writes records as json lines to files in dir. The current file
+// is rotated when it exceeds maxBytes, and only the newest maxFiles files
+// are kept, 0 keeps all. Files are synced after each send.
+type FileSink struct {
+	dir      string
+	prefix   string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewFileSink creates file sink, files are named
+// "<prefix>-<time>.jsonl" so they are sorted by creation time
+func NewFileSink(dir, prefix string, maxBytes int64, maxFiles int) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithMessage(err, "create sink dir error")
+	}
+	return &FileSink{
+		dir:      dir,
+		prefix:   prefix,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+	}, nil
+}
+
+// Send appends records to the current file
+func (s *FileSink) Send(records []*Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil || (s.maxBytes > 0 && s.size >= s.maxBytes) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(s.f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return errors.WithMessage(err, "write record error")
+		}
+	}
+	s.size += int64(w.Buffered())
+	if err := w.Flush(); err != nil {
+		return errors.WithMessage(err, "write records error")
+	}
+	if err := s.f.Sync(); err != nil {
+		return errors.WithMessage(err, "sync sink file error")
+	}
+	return nil
+}
+
+// rotate closes the current file, opens a new one and removes old files
+func (s *FileSink) rotate() error {
+	if s.f != nil {
+		if err := s.f.Close(); err != nil {
+			return errors.WithMessage(err, "close sink file error")
+		}
+		s.f = nil
+	}
+
+	name := s.prefix + "-" + time.Now().UTC().Format("20060102T150405.000000000") + ".jsonl"
+	f, err := os.OpenFile(filepath.Join(s.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.WithMessage(err, "open sink file error")
+	}
+	s.f, s.size = f, 0
+
+	if s.maxFiles <= 0 {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, s.prefix+"-*.jsonl"))
+	if err != nil {
+		return errors.WithMessage(err, "list sink files error")
+	}
+	sort.Strings(files)
+	for len(files) > s.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return errors.WithMessage(err, "remove old sink file error")
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Close closes the current file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
@@ -0,0 +1,59 @@
+package events
+
+import (
+	"encoding/json"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+)
+
+// KafkaSink produces each record as a message of topic, the key is the key
+// of record, so events of a transaction go to the same partition.
+type KafkaSink struct {
+	topic    string
+	producer sarama.SyncProducer
+}
+
+// NewKafkaSink connects brokers, cfg can be nil. Messages are acknowledged
+// by all in-sync replicas, so sent records are not lost.
+func NewKafkaSink(brokers []string, topic string, cfg *sarama.Config) (*KafkaSink, error) {
+	if cfg == nil {
+		cfg = sarama.NewConfig()
+		cfg.Producer.RequiredAcks = sarama.WaitForAll
+		cfg.Producer.Retry.Max = 5
+	}
+	// required by sync producer
+	cfg.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, errors.WithMessage(err, "create kafka producer error")
+	}
+	return &KafkaSink{topic: topic, producer: producer}, nil
+}
+
+// Send produces records and waits the acks
+func (k *KafkaSink) Send(records []*Record) error {
+	msgs := make([]*sarama.ProducerMessage, 0, len(records))
+	for _, r := range records {
+		v, err := json.Marshal(r)
+		if err != nil {
+			return errors.WithMessage(err, "marshal record error")
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: k.topic,
+			Key:   sarama.StringEncoder(r.Key()),
+			Value: sarama.ByteEncoder(v),
+		})
+	}
+
+	if err := k.producer.SendMessages(msgs); err != nil {
+		return errors.WithMessagef(err, "produce records to %s error", k.topic)
+	}
+	return nil
+}
+
+// Close closes producer
+func (k *KafkaSink) Close() error {
+	return k.producer.Close()
+}
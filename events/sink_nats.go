@@ -0,0 +1,52 @@
+package events
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// NATSConn is the part of nats connection used by NATSSink, *nats.Conn
+// implements it
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+	Flush() error
+}
+
+// NATSSink publishes each record to subject "<prefix>.<kind>", e.g.
+// "fabric.tx". The connection is flushed after each send, so records are
+// received by the server when Send returns.
+type NATSSink struct {
+	conn   NATSConn
+	prefix string
+}
+
+// NewNATSSink creates nats sink, the connection is owned by caller, Close
+// does not close it
+func NewNATSSink(conn NATSConn, prefix string) *NATSSink {
+	return &NATSSink{conn: conn, prefix: prefix}
+}
+
+// Send publishes records and flushes
+func (n *NATSSink) Send(records []*Record) error {
+	for _, r := range records {
+		v, err := json.Marshal(r)
+		if err != nil {
+			return errors.WithMessage(err, "marshal record error")
+		}
+		subject := n.prefix + "." + r.Kind
+		if err := n.conn.Publish(subject, v); err != nil {
+			return errors.WithMessagef(err, "publish record to %s error", subject)
+		}
+	}
+
+	if err := n.conn.Flush(); err != nil {
+		return errors.WithMessage(err, "flush nats connection error")
+	}
+	return nil
+}
+
+// Close does nothing
+func (n *NATSSink) Close() error {
+	return nil
+}
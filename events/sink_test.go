@@ -0,0 +1,55 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+)
+
+func assertJSON(t *testing.T, r *Record, want string) {
+	t.Helper()
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("marshal record error: %v", err)
+	}
+	if string(b) != want {
+		t.Fatalf("got record %s, want %s", b, want)
+	}
+}
+
+func TestRecordJSON(t *testing.T) {
+	assertJSON(t, BlockRecord("ch", &Block{Number: 3, DataHash: []byte{1}, PreviousHash: []byte{2},
+		Transactions: []*Transaction{{}}}),
+		`{"kind":"block","channelId":"ch","blockNum":3,"dataHash":"01","previousHash":"02","txCount":1}`)
+
+	// the first transaction of block has index 0, which is encoded
+	tx := &Transaction{
+		Index:          0,
+		TxID:           "tx1",
+		Timestamp:      time.Date(2019, 4, 1, 8, 0, 0, 0, time.UTC),
+		ValidationCode: pb.TxValidationCode_VALID,
+		Actions: []*Action{{
+			ChaincodeID: "mycc",
+			Function:    "invoke",
+			Args:        [][]byte{[]byte("a")},
+			Event:       &pb.ChaincodeEvent{ChaincodeId: "mycc", TxId: "tx1", EventName: "transfer"},
+		}},
+	}
+	records := TxRecords("ch", 3, tx)
+	if len(records) != 2 {
+		t.Fatalf("got %d records of tx, want 2", len(records))
+	}
+	assertJSON(t, records[0], `{"kind":"tx","channelId":"ch","blockNum":3,"txIndex":0,"txId":"tx1",`+
+		`"timestamp":"2019-04-01T08:00:00Z","validationCode":"VALID","chaincodeId":"mycc","function":"invoke","args":["a"]}`)
+	assertJSON(t, records[1], `{"kind":"chaincode","channelId":"ch","blockNum":3,"txIndex":0,"txId":"tx1",`+
+		`"timestamp":"2019-04-01T08:00:00Z","chaincodeId":"mycc","eventName":"transfer"}`)
+
+	// tx status and chaincode events don't have the tx index
+	assertJSON(t, TxStatusRecord("ch", &fab.TxStatusEvent{TxID: "tx1", BlockNumber: 3, TxValidationCode: pb.TxValidationCode_VALID}),
+		`{"kind":"tx","channelId":"ch","blockNum":3,"txId":"tx1","validationCode":"VALID"}`)
+	assertJSON(t, ChaincodeRecord("ch", &fab.CCEvent{TxID: "tx1", ChaincodeID: "mycc", EventName: "transfer", BlockNumber: 3}),
+		`{"kind":"chaincode","channelId":"ch","blockNum":3,"txId":"tx1","chaincodeId":"mycc","eventName":"transfer"}`)
+}
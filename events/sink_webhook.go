@@ -0,0 +1,98 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader is the header of webhook request holding the hmac of body
+const SignatureHeader = "X-Signature-256"
+
+// WebhookSink posts records as a json array to url. If secret is set, the
+// body is signed by hmac-sha256, and the signature is sent in header
+// SignatureHeader as "sha256=<hex>". Failed requests are retried if the
+// error is temporary, i.e. network errors, 429 and 5xx responses.
+type WebhookSink struct {
+	url      string
+	secret   []byte
+	client   *http.Client
+	attempts int
+	delay    time.Duration
+}
+
+// NewWebhookSink creates webhook sink, each request is tried at most
+// attempts times, and the delay between attempts starts from delay.
+func NewWebhookSink(url string, secret []byte, attempts int, delay time.Duration) *WebhookSink {
+	if attempts <= 0 {
+		attempts = 1
+	}
+	return &WebhookSink{
+		url:      url,
+		secret:   secret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		attempts: attempts,
+		delay:    delay,
+	}
+}
+
+// Sign returns the signature of body with secret
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts records to webhook
+func (w *WebhookSink) Send(records []*Record) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return errors.WithMessage(err, "marshal records error")
+	}
+
+	err = retry(w.attempts, w.delay, func() (bool, error) {
+		return w.post(body)
+	})
+	if err != nil {
+		return errors.WithMessagef(err, "post records to %s error", w.url)
+	}
+	return nil
+}
+
+func (w *WebhookSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// read body so the connection can be reused
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, errors.Errorf("unexpected status %s", resp.Status)
+}
+
+// Close does nothing
+func (w *WebhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/pkg/errors"
+)
+
+// Subscriber owns an event client for each channel, and all subscriptions
+// created by it. Subscriptions are not started until Start is called.
+type Subscriber struct {
+	sdk  *fabsdk.FabricSDK
+	user string
+	opts []event.ClientOption
+
+	mu      sync.Mutex
+	clients map[string]fab.EventService
+	subs    []*Subscription
+}
+
+// NewSubscriber creates subscriber, user is the identity to connect event
+// service, opts is used to create event client of each channel
+func NewSubscriber(sdk *fabsdk.FabricSDK, user string, opts ...event.ClientOption) *Subscriber {
+	return &Subscriber{
+		sdk:     sdk,
+		user:    user,
+		opts:    opts,
+		clients: make(map[string]fab.EventService),
+	}
+}
+
+// EventService returns the event client of channel, it is created at the
+// first call
+func (s *Subscriber) EventService(channelID string) (fab.EventService, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.eventService(channelID)
+}
+
+func (s *Subscriber) eventService(channelID string) (fab.EventService, error) {
+	if es, ok := s.clients[channelID]; ok {
+		return es, nil
+	}
+
+	cp := s.sdk.ChannelContext(channelID, fabsdk.WithUser(s.user))
+	ec, err := event.New(cp, s.opts...)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "create event client of %s error", channelID)
+	}
+	s.clients[channelID] = ec
+	return ec, nil
+}
+
+// add creates subscription with the event client of channel
+func (s *Subscriber) add(channelID string, create func(es fab.EventService) *Subscription) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	es, err := s.eventService(channelID)
+	if err != nil {
+		return nil, err
+	}
+	sub := create(es)
+	s.subs = append(s.subs, sub)
+	return sub, nil
+}
+
+// SubscribeBlocks subscribes block events of channel
+func (s *Subscriber) SubscribeBlocks(channelID string, h BlockHandler, filter ...fab.BlockFilter) (*Subscription, error) {
+	return s.add(channelID, func(es fab.EventService) *Subscription {
+		return NewBlockSubscription(es, h, filter...)
+	})
+}
+
+// SubscribeFilteredBlocks subscribes filtered block events of channel
+func (s *Subscriber) SubscribeFilteredBlocks(channelID string, h FilteredBlockHandler) (*Subscription, error) {
+	return s.add(channelID, func(es fab.EventService) *Subscription {
+		return NewFilteredBlockSubscription(es, h)
+	})
+}
+
+// SubscribeTxStatus subscribes status event of transaction txID
+func (s *Subscriber) SubscribeTxStatus(channelID, txID string, h TxStatusHandler) (*Subscription, error) {
+	return s.add(channelID, func(es fab.EventService) *Subscription {
+		return NewTxStatusSubscription(es, txID, h)
+	})
+}
+
+// SubscribeChaincode subscribes events of chaincode ccID in channel
+func (s *Subscriber) SubscribeChaincode(channelID, ccID, eventFilter string, h ChaincodeHandler) (*Subscription, error) {
+	return s.add(channelID, func(es fab.EventService) *Subscription {
+		return NewChaincodeSubscription(es, ccID, eventFilter, h)
+	})
+}
+
+// Start starts all subscriptions, subscriptions started before the failed
+// one keep running
+func (s *Subscriber) Start() error {
+	s.mu.Lock()
+	subs := append([]*Subscription(nil), s.subs...)
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		if err := sub.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove stops sub and forgets it
+func (s *Subscriber) Remove(sub *Subscription) {
+	sub.Stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.subs {
+		if v == sub {
+			s.subs = append(s.subs[:i], s.subs[i+1:]...)
+			break
+		}
+	}
+}
+
+// Close stops all subscriptions
+func (s *Subscriber) Close() {
+	s.mu.Lock()
+	subs := s.subs
+	s.subs = nil
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Stop()
+	}
+}
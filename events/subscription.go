@@ -0,0 +1,286 @@
+// Package events subscribes block, filtered block, transaction status and
+// chaincode events of channels, and delivers them to handlers or channels.
+package events
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// BlockHandler handles block events
+type BlockHandler func(e *fab.BlockEvent)
+
+// FilteredBlockHandler handles filtered block events
+type FilteredBlockHandler func(e *fab.FilteredBlockEvent)
+
+// TxStatusHandler handles transaction status events
+type TxStatusHandler func(e *fab.TxStatusEvent)
+
+// ChaincodeHandler handles chaincode events
+type ChaincodeHandler func(e *fab.CCEvent)
+
+// registerFunc registers to event service, and returns the loop that
+// consumes events until the event channel is closed by Unregister. The
+// loop returning an error should unregister by itself, the subscription
+// keeps the error and stops.
+type registerFunc func(es fab.EventService) (fab.Registration, func() error, error)
+
+// sourceFunc returns the event service to register, and the function to
+// release it after unregistered
+type sourceFunc func() (fab.EventService, func(), error)
+
+func staticSource(es fab.EventService) sourceFunc {
+	return func() (fab.EventService, func(), error) {
+		return es, func() {}, nil
+	}
+}
+
+// Subscription is a registration of events. Events are delivered after
+// Start, and Stop unregisters it and waits the handler to return.
+// A stopped subscription can be started again.
+type Subscription struct {
+	name     string
+	source   sourceFunc
+	register registerFunc
+
+	mu      sync.Mutex
+	es      fab.EventService
+	release func()
+	reg     fab.Registration
+	running bool
+	stop    chan struct{} // closed by Stop before unregistering
+	done    chan struct{}
+	err     error
+}
+
+func newSubscription(name string, source sourceFunc, register registerFunc) *Subscription {
+	done := make(chan struct{})
+	close(done)
+	return &Subscription{
+		name:     name,
+		source:   source,
+		register: register,
+		done:     done,
+	}
+}
+
+// Name describes what the subscription is for
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// Start registers to event service and starts delivering events
+func (s *Subscription) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return nil
+	}
+
+	es, release, err := s.source()
+	if err != nil {
+		return errors.WithMessagef(err, "connect event service for %s error", s.name)
+	}
+	reg, loop, err := s.register(es)
+	if err != nil {
+		release()
+		return errors.WithMessagef(err, "register %s error", s.name)
+	}
+
+	s.es = es
+	s.release = release
+	s.reg = reg
+	s.running = true
+	s.err = nil
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(done chan struct{}) {
+		defer close(done)
+		err := loop()
+
+		s.mu.Lock()
+		s.err = err
+		// failed loop stops the subscription, unless Stop is stopping it
+		failed := err != nil && s.running && s.done == done
+		if failed {
+			s.running = false
+			close(s.stop)
+		}
+		s.mu.Unlock()
+
+		if failed {
+			release()
+		}
+	}(s.done)
+	return nil
+}
+
+// Stop unregisters from event service, events not delivered are dropped
+func (s *Subscription) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = false
+	es, reg, release, done := s.es, s.reg, s.release, s.done
+	close(s.stop)
+	s.mu.Unlock()
+
+	// Unregister closes the event channel, so the loop exits
+	es.Unregister(reg)
+	<-done
+	release()
+}
+
+// stopping returns the channel closed by Stop, handlers blocked on sending
+// should return when it's closed, or Stop waits them forever
+func (s *Subscription) stopping() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stop
+}
+
+// Done is closed when the subscription stopped delivering events
+func (s *Subscription) Done() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.done
+}
+
+// Err returns the error that stopped handling events
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// NewBlockSubscription subscribes block events of es
+func NewBlockSubscription(es fab.EventService, h BlockHandler, filter ...fab.BlockFilter) *Subscription {
+	return newSubscription("block event", staticSource(es), func(es fab.EventService) (fab.Registration, func() error, error) {
+		reg, ch, err := es.RegisterBlockEvent(filter...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reg, func() error {
+			for e := range ch {
+				h(e)
+			}
+			return nil
+		}, nil
+	})
+}
+
+// NewFilteredBlockSubscription subscribes filtered block events of es
+func NewFilteredBlockSubscription(es fab.EventService, h FilteredBlockHandler) *Subscription {
+	return newSubscription("filtered block event", staticSource(es), func(es fab.EventService) (fab.Registration, func() error, error) {
+		reg, ch, err := es.RegisterFilteredBlockEvent()
+		if err != nil {
+			return nil, nil, err
+		}
+		return reg, func() error {
+			for e := range ch {
+				h(e)
+			}
+			return nil
+		}, nil
+	})
+}
+
+// NewTxStatusSubscription subscribes status event of transaction txID
+func NewTxStatusSubscription(es fab.EventService, txID string, h TxStatusHandler) *Subscription {
+	return newSubscription("tx status event of "+txID, staticSource(es), func(es fab.EventService) (fab.Registration, func() error, error) {
+		reg, ch, err := es.RegisterTxStatusEvent(txID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reg, func() error {
+			for e := range ch {
+				h(e)
+			}
+			return nil
+		}, nil
+	})
+}
+
+// NewChaincodeSubscription subscribes events of chaincode ccID, whose name
+// matches regular expression eventFilter
+func NewChaincodeSubscription(es fab.EventService, ccID, eventFilter string, h ChaincodeHandler) *Subscription {
+	name := "chaincode event " + ccID + "/" + eventFilter
+	return newSubscription(name, staticSource(es), func(es fab.EventService) (fab.Registration, func() error, error) {
+		reg, ch, err := es.RegisterChaincodeEvent(ccID, eventFilter)
+		if err != nil {
+			return nil, nil, err
+		}
+		return reg, func() error {
+			for e := range ch {
+				h(e)
+			}
+			return nil
+		}, nil
+	})
+}
+
+// NewBlockChanSubscription subscribes block events of es, and sends them
+// to the returned channel. Sending blocks when the channel is full, and the
+// event is dropped if the subscription is stopped meanwhile. The channel is
+// not closed by Stop, as the subscription can be started again.
+func NewBlockChanSubscription(es fab.EventService, size int, filter ...fab.BlockFilter) (*Subscription, <-chan *fab.BlockEvent) {
+	ch := make(chan *fab.BlockEvent, size)
+	var sub *Subscription
+	sub = NewBlockSubscription(es, func(e *fab.BlockEvent) {
+		select {
+		case ch <- e:
+		case <-sub.stopping():
+		}
+	}, filter...)
+	return sub, ch
+}
+
+// NewFilteredBlockChanSubscription is NewBlockChanSubscription for filtered
+// block events
+func NewFilteredBlockChanSubscription(es fab.EventService, size int) (*Subscription, <-chan *fab.FilteredBlockEvent) {
+	ch := make(chan *fab.FilteredBlockEvent, size)
+	var sub *Subscription
+	sub = NewFilteredBlockSubscription(es, func(e *fab.FilteredBlockEvent) {
+		select {
+		case ch <- e:
+		case <-sub.stopping():
+		}
+	})
+	return sub, ch
+}
+
+// NewTxStatusChanSubscription is NewBlockChanSubscription for status event
+// of transaction txID
+func NewTxStatusChanSubscription(es fab.EventService, txID string, size int) (*Subscription, <-chan *fab.TxStatusEvent) {
+	ch := make(chan *fab.TxStatusEvent, size)
+	var sub *Subscription
+	sub = NewTxStatusSubscription(es, txID, func(e *fab.TxStatusEvent) {
+		select {
+		case ch <- e:
+		case <-sub.stopping():
+		}
+	})
+	return sub, ch
+}
+
+// NewChaincodeChanSubscription is NewBlockChanSubscription for chaincode
+// events
+func NewChaincodeChanSubscription(es fab.EventService, ccID, eventFilter string, size int) (*Subscription, <-chan *fab.CCEvent) {
+	ch := make(chan *fab.CCEvent, size)
+	var sub *Subscription
+	sub = NewChaincodeSubscription(es, ccID, eventFilter, func(e *fab.CCEvent) {
+		select {
+		case ch <- e:
+		case <-sub.stopping():
+		}
+	})
+	return sub, ch
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// TxResult is the final status of a tracked transaction, Event is nil if
+// Err is not nil
+type TxResult struct {
+	TxID  string
+	Event *fab.TxStatusEvent
+	Err   error
+}
+
+// TxResultHandler handles the result of a tracked transaction
+type TxResultHandler func(r *TxResult)
+
+// TxTracker waits the status events of transactions. Each transaction is
+// registered until its status arrives or timeout, and at most maxPending
+// transactions are registered at the same time.
+type TxTracker struct {
+	es      fab.EventService
+	timeout time.Duration
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewTxTracker creates tracker with event service es, maxPending and
+// timeout must be positive
+func NewTxTracker(es fab.EventService, maxPending int, timeout time.Duration) (*TxTracker, error) {
+	if maxPending <= 0 {
+		return nil, errors.Errorf("invalid max pending %d", maxPending)
+	}
+	if timeout <= 0 {
+		return nil, errors.Errorf("invalid timeout %v", timeout)
+	}
+	return &TxTracker{
+		es:      es,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxPending),
+	}, nil
+}
+
+// NewTxTracker creates tracker with the event client of channel
+func (s *Subscriber) NewTxTracker(channelID string, maxPending int, timeout time.Duration) (*TxTracker, error) {
+	es, err := s.EventService(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return NewTxTracker(es, maxPending, timeout)
+}
+
+// Track registers status event of txID, h is called in another goroutine
+// with the result. It blocks while maxPending transactions are pending.
+func (t *TxTracker) Track(txID string, h TxResultHandler) error {
+	t.slots <- struct{}{}
+
+	reg, ch, err := t.es.RegisterTxStatusEvent(txID)
+	if err != nil {
+		<-t.slots
+		return errors.WithMessagef(err, "register tx status event of %s error", txID)
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		r := t.wait(txID, ch)
+		t.es.Unregister(reg)
+		<-t.slots
+		h(r)
+	}()
+	return nil
+}
+
+func (t *TxTracker) wait(txID string, ch <-chan *fab.TxStatusEvent) *TxResult {
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			return &TxResult{TxID: txID, Err: errors.Errorf("tx status event channel of %s closed", txID)}
+		}
+		return &TxResult{TxID: txID, Event: e}
+	case <-timer.C:
+		return &TxResult{TxID: txID, Err: errors.Errorf("wait tx status event of %s timeout", txID)}
+	}
+}
+
+// Wait waits all tracked transactions finished
+func (t *TxTracker) Wait() {
+	t.wg.Wait()
+}
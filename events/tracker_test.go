@@ -0,0 +1,27 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTxTrackerValidates(t *testing.T) {
+	tests := []struct {
+		maxPending int
+		timeout    time.Duration
+		valid      bool
+	}{
+		{1, time.Second, true},
+		{0, time.Second, false},
+		{-1, time.Second, false},
+		{1, 0, false},
+		{1, -time.Second, false},
+	}
+	for _, test := range tests {
+		_, err := NewTxTracker(&mockBlockService{}, test.maxPending, test.timeout)
+		if (err == nil) != test.valid {
+			t.Fatalf("max pending %d, timeout %v: got error %v, want valid %v",
+				test.maxPending, test.timeout, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package events
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+)
+
+// AlertKind is the kind of integrity violation
+type AlertKind int
+
+const (
+	// DataHashMismatch means the data hash in header is not the hash of
+	// block data
+	DataHashMismatch AlertKind = iota
+	// PreviousHashMismatch means the previous hash in header is not the
+	// header hash of previous block
+	PreviousHashMismatch
+	// BlockGap means the block is not next to the previous block, so the
+	// chain can't be checked, verification continues from this block
+	BlockGap
+)
+
+func (k AlertKind) String() string {
+	switch k {
+	case DataHashMismatch:
+		return "DataHashMismatch"
+	case PreviousHashMismatch:
+		return "PreviousHashMismatch"
+	case BlockGap:
+		return "BlockGap"
+	}
+	return "Unknown"
+}
+
+// IntegrityAlert reports a block which failed verification. Expected and
+// Actual are the hashes of hash mismatches, ExpectedBlock is the block
+// number expected by BlockGap, while BlockNum is the actual one.
+type IntegrityAlert struct {
+	Kind          AlertKind
+	BlockNum      uint64
+	Expected      []byte
+	Actual        []byte
+	ExpectedBlock uint64
+	Time          time.Time
+}
+
+func (a *IntegrityAlert) String() string {
+	if a.Kind == BlockGap {
+		return fmt.Sprintf("block %d: %v, expected block %d", a.BlockNum, a.Kind, a.ExpectedBlock)
+	}
+	return fmt.Sprintf("block %d: %v, expected %s, actual %s", a.BlockNum, a.Kind,
+		hex.EncodeToString(a.Expected), hex.EncodeToString(a.Actual))
+}
+
+// AlertHandler handles integrity alerts
+type AlertHandler func(a *IntegrityAlert)
+
+// ChainVerifier verifies the hash chain of blocks delivered in order: the
+// data hash of each block, and the previous hash against the header hash
+// of previous block.
+type ChainVerifier struct {
+	onAlert AlertHandler
+
+	mu       sync.Mutex
+	known    bool
+	lastNum  uint64
+	lastHash []byte
+}
+
+// NewChainVerifier creates verifier, alerts are logged if onAlert is nil
+func NewChainVerifier(onAlert AlertHandler) *ChainVerifier {
+	if onAlert == nil {
+		onAlert = func(a *IntegrityAlert) {
+			log.Printf("Block integrity alert: %v", a)
+		}
+	}
+	return &ChainVerifier{onAlert: onAlert}
+}
+
+// Anchor trusts block num whose header hash is hash, the next block is
+// verified against it. Without anchor, the first block is trusted.
+func (v *ChainVerifier) Anchor(num uint64, hash []byte) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.known, v.lastNum, v.lastHash = true, num, hash
+}
+
+// Verify checks block and returns the alerts, which are also sent to the
+// alert handler. Block without header is an error, and the chain state is
+// not changed by it.
+func (v *ChainVerifier) Verify(b *common.Block) ([]*IntegrityAlert, error) {
+	if b == nil || b.Header == nil {
+		return nil, errors.New("block without header")
+	}
+
+	v.mu.Lock()
+	var alerts []*IntegrityAlert
+	alert := func(a *IntegrityAlert) {
+		a.BlockNum, a.Time = b.Header.Number, time.Now()
+		alerts = append(alerts, a)
+	}
+
+	if dataHash := BlockDataHash(b.Data); !bytes.Equal(dataHash, b.Header.DataHash) {
+		alert(&IntegrityAlert{Kind: DataHashMismatch, Expected: dataHash, Actual: b.Header.DataHash})
+	}
+	if v.known {
+		if b.Header.Number != v.lastNum+1 {
+			alert(&IntegrityAlert{Kind: BlockGap, ExpectedBlock: v.lastNum + 1})
+		} else if !bytes.Equal(v.lastHash, b.Header.PreviousHash) {
+			alert(&IntegrityAlert{Kind: PreviousHashMismatch, Expected: v.lastHash, Actual: b.Header.PreviousHash})
+		}
+	}
+	v.known, v.lastNum, v.lastHash = true, b.Header.Number, BlockHeaderHash(b.Header)
+	v.mu.Unlock()
+
+	for _, a := range alerts {
+		v.onAlert(a)
+	}
+	return alerts, nil
+}
+
+// Handler verifies blocks before passing them to next
+func (v *ChainVerifier) Handler(next BlockHandler) BlockHandler {
+	return func(e *fab.BlockEvent) {
+		if _, err := v.Verify(e.Block); err != nil {
+			log.Printf("Verify block error: %v", err)
+		}
+		next(e)
+	}
+}
+
+type asn1Header struct {
+	Number       *big.Int
+	PreviousHash []byte
+	DataHash     []byte
+}
+
+// BlockHeaderHash computes the hash of header as fabric does, it's the
+// sha256 of asn1 encoded header
+func BlockHeaderHash(h *common.BlockHeader) []byte {
+	b, err := asn1.Marshal(asn1Header{
+		Number:       new(big.Int).SetUint64(h.Number),
+		PreviousHash: h.PreviousHash,
+		DataHash:     h.DataHash,
+	})
+	if err != nil {
+		// it never fails for this structure
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// BlockDataHash computes the hash of block data as fabric does, it's the
+// sha256 of concatenated transactions
+func BlockDataHash(d *common.BlockData) []byte {
+	h := sha256.New()
+	if d != nil {
+		for _, data := range d.Data {
+			h.Write(data)
+		}
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+)
+
+// newChain creates n blocks from block 0, each links to the previous one
+func newChain(n int) []*common.Block {
+	var blocks []*common.Block
+	var prev []byte
+	for i := 0; i < n; i++ {
+		data := &common.BlockData{Data: [][]byte{[]byte(fmt.Sprintf("tx of block %d", i))}}
+		b := &common.Block{
+			Header: &common.BlockHeader{
+				Number:       uint64(i),
+				PreviousHash: prev,
+				DataHash:     BlockDataHash(data),
+			},
+			Data: data,
+		}
+		prev = BlockHeaderHash(b.Header)
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// verifyChain verifies blocks in order, and returns alerts of all blocks
+func verifyChain(t *testing.T, blocks []*common.Block) []*IntegrityAlert {
+	var handled []*IntegrityAlert
+	v := NewChainVerifier(func(a *IntegrityAlert) {
+		handled = append(handled, a)
+	})
+
+	var alerts []*IntegrityAlert
+	for _, b := range blocks {
+		as, err := v.Verify(b)
+		if err != nil {
+			t.Fatalf("verify block %d error: %v", b.Header.Number, err)
+		}
+		alerts = append(alerts, as...)
+	}
+	if len(handled) != len(alerts) {
+		t.Fatalf("handled %d alerts, returned %d", len(handled), len(alerts))
+	}
+	return alerts
+}
+
+func assertAlert(t *testing.T, alerts []*IntegrityAlert, kind AlertKind, blockNum uint64) {
+	t.Helper()
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts %v, want 1", len(alerts), alerts)
+	}
+	if a := alerts[0]; a.Kind != kind || a.BlockNum != blockNum {
+		t.Fatalf("got alert %v, want %v of block %d", a, kind, blockNum)
+	}
+}
+
+func TestVerifyValidChain(t *testing.T) {
+	if alerts := verifyChain(t, newChain(5)); len(alerts) != 0 {
+		t.Fatalf("got alerts %v of valid chain", alerts)
+	}
+}
+
+func TestVerifyTamperedDataHash(t *testing.T) {
+	blocks := newChain(5)
+	blocks[2].Data.Data[0] = []byte("tampered")
+
+	alerts := verifyChain(t, blocks)
+	assertAlert(t, alerts, DataHashMismatch, 2)
+	if string(alerts[0].Actual) != string(blocks[2].Header.DataHash) {
+		t.Fatalf("actual hash %x, want header data hash %x", alerts[0].Actual, blocks[2].Header.DataHash)
+	}
+}
+
+func TestVerifyWrongPreviousHash(t *testing.T) {
+	blocks := newChain(5)
+	expected := blocks[3].Header.PreviousHash
+	blocks[3].Header.PreviousHash = []byte("wrong")
+
+	alerts := verifyChain(t, blocks)
+	// block 4 links to the original header of block 3, so it's alerted too
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts %v, want 2", len(alerts), alerts)
+	}
+	assertAlert(t, alerts[:1], PreviousHashMismatch, 3)
+	if string(alerts[0].Expected) != string(expected) {
+		t.Fatalf("expected hash %x, want %x", alerts[0].Expected, expected)
+	}
+	assertAlert(t, alerts[1:], PreviousHashMismatch, 4)
+}
+
+func TestVerifyBlockGap(t *testing.T) {
+	blocks := newChain(5)
+	// block 2 is missing, verification continues from block 3
+	alerts := verifyChain(t, append(blocks[:2:2], blocks[3:]...))
+	assertAlert(t, alerts, BlockGap, 3)
+	if a := alerts[0]; a.ExpectedBlock != 2 || a.Expected != nil || a.Actual != nil {
+		t.Fatalf("got gap alert %+v, want expected block 2 without hashes", a)
+	}
+}
+
+func TestVerifyWithoutHeader(t *testing.T) {
+	v := NewChainVerifier(func(a *IntegrityAlert) {})
+	if _, err := v.Verify(&common.Block{}); err == nil {
+		t.Fatal("verify block without header should fail")
+	}
+	if _, err := v.Verify(nil); err == nil {
+		t.Fatal("verify nil block should fail")
+	}
+}
@@ -3,9 +3,10 @@ module github.com/shitaibin/fabric-sdk-go-sample
 go 1.12
 
 require (
-	github.com/Shopify/sarama v1.23.1 // indirect
+	github.com/Shopify/sarama v1.23.1
 	github.com/cloudflare/cfssl v0.0.0-20180323000720-5d63dbd981b5 // indirect
 	github.com/fsouza/go-dockerclient v1.4.4 // indirect
+	github.com/golang/protobuf v1.3.0
 	github.com/google/pprof v0.0.0-20190723021845-34ac40c74b70 // indirect
 	github.com/grpc-ecosystem/go-grpc-middleware v1.0.0 // indirect
 	github.com/hashicorp/go-version v1.2.0 // indirect
@@ -15,6 +16,7 @@ require (
 	github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric v0.0.0-20190411180201-5a9a0e749e4f
 	github.com/ianlancetaylor/demangle v0.0.0-20181102032728-5e5cf60278f6 // indirect
 	github.com/magiconair/properties v1.8.0 // indirect
+	github.com/mattn/go-sqlite3 v1.11.0
 	github.com/mitchellh/mapstructure v0.0.0-20180511142126-bb74f1db0675 // indirect
 	github.com/modood/table v0.0.0-20181112072225-499dc7fba710 // indirect
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7 // indirect
@@ -25,6 +27,7 @@ require (
 	github.com/spf13/afero v1.1.1 // indirect
 	github.com/stretchr/objx v0.2.0 // indirect
 	github.com/sykesm/zap-logfmt v0.0.2 // indirect
+	go.etcd.io/bbolt v1.3.3
 	go.uber.org/zap v1.10.0 // indirect
 	golang.org/x/arch v0.0.0-20190909030613-46d78d1859ac // indirect
 	gopkg.in/jcmturner/goidentity.v3 v3.0.0 // indirect
@@ -0,0 +1,293 @@
+// Package projection projects the state of chaincode_example02 into a SQL
+// database from block events, so it can be queried by reporting tools.
+package projection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	"github.com/pkg/errors"
+	"github.com/shitaibin/fabric-sdk-go-sample/chaincode/types"
+	"github.com/shitaibin/fabric-sdk-go-sample/events"
+	"github.com/shitaibin/fabric-sdk-go-sample/rwset"
+
+	// sqlite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS accounts (
+		name      TEXT PRIMARY KEY,
+		balance   INTEGER,
+		value     BLOB,
+		block_num INTEGER NOT NULL,
+		tx_num    INTEGER NOT NULL,
+		tx_id     TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS transactions (
+		block_num INTEGER NOT NULL,
+		tx_num    INTEGER NOT NULL,
+		tx_id     TEXT NOT NULL,
+		function  TEXT NOT NULL,
+		PRIMARY KEY (block_num, tx_num)
+	)`,
+	`CREATE TABLE IF NOT EXISTS projection (
+		id         INTEGER PRIMARY KEY,
+		next_block INTEGER NOT NULL
+	)`,
+}
+
+// Projector applies the write sets of valid transactions of chaincode to
+// tables, the position is saved in the same database transaction as the
+// data, so each block is applied exactly once.
+type Projector struct {
+	db          *sql.DB
+	chaincodeID string
+
+	mu  sync.Mutex
+	err error
+}
+
+// OpenSQLite opens or creates sqlite database at path for chaincode
+func OpenSQLite(path, chaincodeID string) (*Projector, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, errors.WithMessage(err, "open sqlite error")
+	}
+	// sqlite allows one writer
+	db.SetMaxOpenConns(1)
+
+	p, err := New(db, chaincodeID)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// New creates projector with db, the statements use "?" placeholders
+func New(db *sql.DB, chaincodeID string) (*Projector, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, errors.WithMessage(err, "create table error")
+		}
+	}
+	return &Projector{db: db, chaincodeID: chaincodeID}, nil
+}
+
+// Close closes database
+func (p *Projector) Close() error {
+	return p.db.Close()
+}
+
+// NextBlock returns the block to apply next
+func (p *Projector) NextBlock() (uint64, error) {
+	return nextBlock(p.db)
+}
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func nextBlock(q queryer) (uint64, error) {
+	var next uint64
+	err := q.QueryRow(`SELECT next_block FROM projection WHERE id = 1`).Scan(&next)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.WithMessage(err, "query next block error")
+	}
+	return next, nil
+}
+
+// Apply applies block, blocks before the next block are skipped, and
+// blocks must be applied in order
+func (p *Projector) Apply(b *common.Block) error {
+	block, err := events.DecodeBlock(b)
+	if err != nil {
+		return err
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return errors.WithMessage(err, "begin transaction error")
+	}
+	defer tx.Rollback()
+
+	next, err := nextBlock(tx)
+	if err != nil {
+		return err
+	}
+	if block.Number < next {
+		return nil
+	}
+	if block.Number > next {
+		return errors.Errorf("block %d is not next block %d", block.Number, next)
+	}
+
+	for _, t := range block.Transactions {
+		// write sets of invalid transactions are not committed
+		if !t.Valid() {
+			continue
+		}
+		if err := p.applyTx(tx, block.Number, t); err != nil {
+			return errors.WithMessagef(err, "apply tx %s error", t.TxID)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT OR REPLACE INTO projection (id, next_block) VALUES (1, ?)`, block.Number+1)
+	if err != nil {
+		return errors.WithMessage(err, "save next block error")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.WithMessagef(err, "commit block %d error", block.Number)
+	}
+	return nil
+}
+
+func (p *Projector) applyTx(tx *sql.Tx, blockNum uint64, t *events.Transaction) error {
+	for _, a := range t.Actions {
+		applied := false
+		for _, ns := range a.RWSets {
+			if ns.Namespace != p.chaincodeID {
+				continue
+			}
+			for _, w := range ns.Writes {
+				if err := p.applyWrite(tx, blockNum, t, w); err != nil {
+					return err
+				}
+				applied = true
+			}
+		}
+		if applied {
+			_, err := tx.Exec(`INSERT OR REPLACE INTO transactions (block_num, tx_num, tx_id, function) VALUES (?, ?, ?, ?)`,
+				blockNum, t.Index, t.TxID, a.Function)
+			if err != nil {
+				return errors.WithMessage(err, "insert transaction error")
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Projector) applyWrite(tx *sql.Tx, blockNum uint64, t *events.Transaction, w rwset.KVWrite) error {
+	// only the keys of account namespace are projected
+	objectType, attrs, ok := types.SplitCompositeKey(w.Key)
+	if !ok || objectType != types.AccountObjectType || len(attrs) != 1 {
+		return nil
+	}
+	name := attrs[0]
+
+	if w.IsDelete {
+		if _, err := tx.Exec(`DELETE FROM accounts WHERE name = ?`, name); err != nil {
+			return errors.WithMessagef(err, "delete account %s error", name)
+		}
+		return nil
+	}
+
+	// example02 stores account as json document, the whole document is
+	// kept in value
+	var balance interface{}
+	account := types.Account{}
+	if err := json.Unmarshal(w.Value, &account); err == nil {
+		balance = int64(account.Balance)
+	}
+	_, err := tx.Exec(`INSERT OR REPLACE INTO accounts (name, balance, value, block_num, tx_num, tx_id) VALUES (?, ?, ?, ?, ?, ?)`,
+		name, balance, w.Value, blockNum, t.Index, t.TxID)
+	if err != nil {
+		return errors.WithMessagef(err, "upsert account %s error", name)
+	}
+	return nil
+}
+
+// Handler applies blocks of event. If a block fails, the following blocks
+// are not applied, and Err returns the error, the projection resumes from
+// the failed block at next subscription.
+func (p *Projector) Handler() events.BlockHandler {
+	return func(e *fab.BlockEvent) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.err != nil {
+			return
+		}
+		if err := p.Apply(e.Block); err != nil {
+			p.err = err
+			log.Printf("Projection stopped: %v", err)
+		}
+	}
+}
+
+// Err returns the error that stopped projection
+func (p *Projector) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.err
+}
+
+// Reset deletes all projected data, the next block is the genesis block
+func (p *Projector) Reset() error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return errors.WithMessage(err, "begin transaction error")
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"accounts", "transactions", "projection"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return errors.WithMessagef(err, "clear %s error", table)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.WithMessage(err, "commit reset error")
+	}
+
+	p.mu.Lock()
+	p.err = nil
+	p.mu.Unlock()
+	return nil
+}
+
+// Rebuild resets projection and applies all blocks of channel from the
+// genesis block, workers is the number of parallel fetches
+func (p *Projector) Rebuild(s *events.Subscriber, channelID string, workers int) error {
+	if err := p.Reset(); err != nil {
+		return err
+	}
+	err := s.Replay(channelID, 0, math.MaxUint64, events.ReplayHandlers{Block: p.Handler()}, workers)
+	if err != nil {
+		return err
+	}
+	return p.Err()
+}
+
+// Subscribe subscribes blocks of channel from the next block, the
+// subscription is started by subscriber
+func (p *Projector) Subscribe(s *events.Subscriber, channelID string) (*events.Subscription, error) {
+	next, err := p.NextBlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.SubscribeResilient(channelID, p.Handler(), nil, events.WithStartBlock(next))
+}
+
+// Balance returns the projected balance of account, false if the account
+// does not exist
+func (p *Projector) Balance(name string) (int64, bool, error) {
+	var balance sql.NullInt64
+	err := p.db.QueryRow(`SELECT balance FROM accounts WHERE name = ?`, name).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.WithMessagef(err, "query balance of %s error", name)
+	}
+	return balance.Int64, balance.Valid, nil
+}
@@ -0,0 +1,88 @@
+// Package rwset decodes the read write sets of transactions, which are
+// shared by endorsement checks of cli and block decoding of events.
+package rwset
+
+import (
+	"github.com/golang/protobuf/proto"
+	fabrwset "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/ledger/rwset"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/ledger/rwset/kvrwset"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+)
+
+// NsReadWriteSet is the decoded read write set of a namespace, the
+// namespace is the chaincode ID.
+type NsReadWriteSet struct {
+	Namespace string
+	Reads     []KVRead
+	Writes    []KVWrite
+}
+
+// KVRead is a key read by the chaincode, Exists is false when the key was
+// not in the state db, then the version is meaningless.
+type KVRead struct {
+	Key      string
+	Exists   bool
+	BlockNum uint64
+	TxNum    uint64
+}
+
+// KVWrite is a key written by the chaincode, deleted key has IsDelete set
+// and no value.
+type KVWrite struct {
+	Key      string
+	IsDelete bool
+	Value    []byte
+}
+
+// UnmarshalChaincodeAction get the chaincode action from the payload of a
+// proposal response
+func UnmarshalChaincodeAction(proposalResponsePayload []byte) (*pb.ChaincodeAction, error) {
+	prp := &pb.ProposalResponsePayload{}
+	if err := proto.Unmarshal(proposalResponsePayload, prp); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal proposal response payload error")
+	}
+
+	ca := &pb.ChaincodeAction{}
+	if err := proto.Unmarshal(prp.Extension, ca); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal chaincode action error")
+	}
+	return ca, nil
+}
+
+// UnmarshalTxReadWriteSet decodes the results of chaincode action into the
+// read write set of each namespace
+func UnmarshalTxReadWriteSet(results []byte) ([]NsReadWriteSet, error) {
+	txRWSet := &fabrwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txRWSet); err != nil {
+		return nil, errors.WithMessage(err, "unmarshal tx read write set error")
+	}
+
+	nsSets := make([]NsReadWriteSet, 0, len(txRWSet.NsRwset))
+	for _, ns := range txRWSet.NsRwset {
+		kvSet := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(ns.Rwset, kvSet); err != nil {
+			return nil, errors.WithMessagef(err, "unmarshal kv read write set of %s error", ns.Namespace)
+		}
+
+		nsSet := NsReadWriteSet{Namespace: ns.Namespace}
+		for _, r := range kvSet.Reads {
+			read := KVRead{Key: r.Key}
+			if r.Version != nil {
+				read.Exists = true
+				read.BlockNum = r.Version.BlockNum
+				read.TxNum = r.Version.TxNum
+			}
+			nsSet.Reads = append(nsSet.Reads, read)
+		}
+		for _, w := range kvSet.Writes {
+			nsSet.Writes = append(nsSet.Writes, KVWrite{
+				Key:      w.Key,
+				IsDelete: w.IsDelete,
+				Value:    w.Value,
+			})
+		}
+		nsSets = append(nsSets, nsSet)
+	}
+	return nsSets, nil
+}
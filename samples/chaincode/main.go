@@ -93,4 +93,38 @@ func Phase2(cli1, cli2 *cli.Client) {
 		log.Panicf("Query chaincode error: %v", err)
 	}
 	log.Println("Query chaincode success on peer0.org2")
+
+	history, err := cli1.QueryHistory("peer0.org2.example.com", "a")
+	if err != nil {
+		log.Panicf("Query history error: %v", err)
+	}
+	for _, h := range history {
+		log.Printf("History of a: tx: %s, value: %s, time: %v, deleted: %v",
+			h.TxID, h.Value, h.Timestamp, h.IsDelete)
+	}
+
+	// list all accounts page by page
+	for bookmark := ""; ; {
+		page, err := cli1.ListAccounts("peer0.org2.example.com", 10, bookmark)
+		if err != nil {
+			log.Panicf("List accounts error: %v", err)
+		}
+		for _, a := range page.Accounts {
+			log.Printf("Account %s: balance: %d, owner: %s of %s", a.Name, a.Balance, a.Owner.Subject, a.Owner.MSPID)
+		}
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+
+	// rich query needs CouchDB, start byfn with "-s couchdb"
+	page, err := cli1.QueryAccountsByOwner("peer0.org2.example.com", "Org1MSP", "", 10, "")
+	if err != nil {
+		log.Printf("Query accounts by owner error: %v", err)
+		return
+	}
+	for _, a := range page.Accounts {
+		log.Printf("Account %s of Org1MSP: balance: %d, updated: %v", a.Name, a.Balance, a.Updated)
+	}
 }
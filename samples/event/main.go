@@ -2,20 +2,26 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
 	"log"
+	"math"
 	"time"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient/seek"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
-	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/shitaibin/fabric-sdk-go-sample/chaincode/types"
 	"github.com/shitaibin/fabric-sdk-go-sample/cli"
+	"github.com/shitaibin/fabric-sdk-go-sample/events"
 )
 
 const (
 	org1CfgPath = "../../config/org1sdk-config.yaml"
 	org2CfgPath = "../../config/org2sdk-config.yaml"
+
+	checkpointDir = "/tmp/event-checkpoints"
+	sinkDir       = "/tmp/event-sink"
 )
 
 var (
@@ -23,34 +29,115 @@ var (
 	peer0Org2 = "peer0.org2.example.com"
 )
 
+var replayFrom = flag.Int64("replay-from", -1, "replay blocks from this block to the newest before listening, -1 disables replay")
+
 func main() {
+	flag.Parse()
+
 	org1Client := cli.New(org1CfgPath, "Org1", "Admin", "User1")
 	org2Client := cli.New(org2CfgPath, "Org2", "Admin", "User1")
 	defer org1Client.Close()
 	defer org2Client.Close()
 
-	// New event client
-	cp := org1Client.SDK.ChannelContext(org1Client.ChannelID, fabsdk.WithUser(org1Client.OrgUser))
+	// Checkpointer, sink and buffer should be closed after subscriber
+	cp, err := events.NewFileCheckpointer(checkpointDir)
+	if err != nil {
+		log.Panicf("Create checkpointer error: %v", err)
+	}
+	defer cp.Close()
 
-	ec, err := event.New(
-		cp,
+	// forward events to json lines files, files are rotated every 10MB
+	fileSink, err := events.NewFileSink(sinkDir, "events", 10<<20, 10)
+	if err != nil {
+		log.Panicf("Create file sink error: %v", err)
+	}
+	defer fileSink.Close()
+
+	// buffer block events for slow listener, spill to disk when full
+	blockBuf, bufferedBlockListener, err := events.NewBlockBuffer(blockListener,
+		events.BufferConfig{Size: 100, Strategy: events.SpillToDisk})
+	if err != nil {
+		log.Panicf("Create block buffer error: %v", err)
+	}
+	defer func() {
+		blockBuf.Close()
+		log.Printf("Block buffer metrics: %+v", blockBuf.Metrics())
+	}()
+
+	// New event subscriber
+	sub := events.NewSubscriber(
+		org1Client.SDK,
+		org1Client.OrgUser,
 		event.WithBlockEvents(), // 如果没有，会是filtered
 		// event.WithBlockNum(1), // 从指定区块获取，需要此参数
 		event.WithSeekType(seek.Newest))
+	defer sub.Close()
+
+	// block event listen, reconnect to other peers and backfill missed blocks
+	// if connection drops, and verify hash chain of blocks
+	verifier := events.NewChainVerifier(integrityAlertListener)
+	if _, err := sub.SubscribeResilient(org1Client.ChannelID, verifier.Handler(bufferedBlockListener), connectionListener); err != nil {
+		log.Printf("Subscribe block event error: %v", err)
+	}
+	// full blocks if permitted, otherwise filtered blocks
+	negotiated, err := sub.SubscribeNegotiated(org1Client.ChannelID, unifiedBlockListener)
 	if err != nil {
-		log.Printf("Create event client error: %v", err)
+		log.Printf("Subscribe negotiated block event error: %v", err)
+	}
+
+	// chaincode event listen
+	router := events.NewRouter()
+	eventName := ".*"
+	log.Printf("Listen chaincode event: %v", eventName)
+	if err := router.Handle(org1Client.CCID, eventName, events.RawPayload, chainCodeEventListener); err != nil {
+		log.Panicf("Add chaincode event route error: %v", err)
+	}
+	if err := router.Handle(org1Client.CCID, types.TransferEvent, events.JSONPayload(types.Transfer{}), transferListener); err != nil {
+		log.Panicf("Add chaincode event route error: %v", err)
+	}
+	if err := router.Handle(org1Client.CCID, types.DeletedEvent, events.JSONPayload(types.Deleted{}), deletedListener); err != nil {
+		log.Panicf("Add chaincode event route error: %v", err)
+	}
+	if _, err := sub.SubscribeRouter(org1Client.ChannelID, router); err != nil {
+		log.Printf("Subscribe chaincode event error: %v", err)
 	}
 
-	// block event listen
-	defer ec.Unregister(blockListener(ec))
-	defer ec.Unregister(filteredBlockListener(ec))
+	// checkpointed block listen, resume from last processed block after restart
+	if _, err := sub.SubscribeCheckpointed(org1Client.ChannelID, "sample-blocks", cp, checkpointedBlockListener); err != nil {
+		log.Printf("Subscribe checkpointed block event error: %v", err)
+	}
+
+	// forward events to the file sink, at least once
+	if _, err := sub.SubscribeCheckpointed(org1Client.ChannelID, "sample-sink", cp,
+		events.SinkHandler(org1Client.ChannelID, fileSink)); err != nil {
+		log.Printf("Subscribe sink error: %v", err)
+	}
+
+	// replay history blocks through the same listeners
+	if *replayFrom >= 0 {
+		log.Printf("Replay blocks from %v", *replayFrom)
+		err := sub.Replay(org1Client.ChannelID, uint64(*replayFrom), math.MaxUint64,
+			events.ReplayHandlers{Block: blockListener, Chaincode: router.Dispatch}, 4)
+		if err != nil {
+			log.Printf("Replay blocks error: %v", err)
+		}
+	}
+
+	if err := sub.Start(); err != nil {
+		log.Printf("Start event subscriber error: %v", err)
+	}
+	log.Println("Registered block, filtered block and chaincode event")
+	if negotiated != nil {
+		log.Printf("Negotiated block delivery mode: %v", negotiated.Mode())
+	}
 
 	// tx listen
+	tracker, err := sub.NewTxTracker(org1Client.ChannelID, 10, time.Minute)
+	if err != nil {
+		log.Panicf("Create tx tracker error: %v", err)
+	}
 	txIDCh := make(chan string, 100)
-	go txListener(ec, txIDCh)
-
-	// chaincode event listen
-	defer ec.Unregister(chainCodeEventListener(nil, ec))
+	go txListener(tracker, txIDCh)
 
 	DoChainCode(org1Client, txIDCh)
 	close(txIDCh)
@@ -58,116 +145,112 @@ func main() {
 	time.Sleep(time.Second * 10)
 }
 
-func blockListener(ec *event.Client) fab.Registration {
-	// Register monitor block event
-	beReg, beCh, err := ec.RegisterBlockEvent()
+func blockListener(e *fab.BlockEvent) {
+	log.Printf("Receive block event:\nSourceURL: %v\nNumber: %v\nHash"+
+		": %v\nPreviousHash: %v\n\n",
+		e.SourceURL,
+		e.Block.Header.Number,
+		hex.EncodeToString(e.Block.Header.DataHash),
+		hex.EncodeToString(e.Block.Header.PreviousHash))
+
+	block, err := events.DecodeBlock(e.Block)
 	if err != nil {
-		log.Printf("Register block event error: %v", err)
-	}
-	log.Println("Registered block event")
-
-	// Receive block event
-	go func() {
-		for e := range beCh {
-			log.Printf("Receive block event:\nSourceURL: %v\nNumber: %v\nHash"+
-				": %v\nPreviousHash: %v\n\n",
-				e.SourceURL,
-				e.Block.Header.Number,
-				hex.EncodeToString(e.Block.Header.DataHash),
-				hex.EncodeToString(e.Block.Header.PreviousHash))
+		log.Printf("Decode block error: %v", err)
+		return
+	}
+	for _, tx := range block.Transactions {
+		log.Printf("tx index %d: txid: %v, type: %v, creator: %v, "+
+			"validation code: %v, time: %v", tx.Index, tx.TxID, tx.Type,
+			tx.Creator.MSPID, tx.ValidationCode, tx.Timestamp)
+		for _, a := range tx.Actions {
+			var endorsers []string
+			for _, id := range a.Endorsers {
+				endorsers = append(endorsers, id.MSPID)
+			}
+			log.Printf("  chaincode: %v:%v, fcn: %v, args: %q, endorsers: %v",
+				a.ChaincodeID, a.Version, a.Function, a.Args, endorsers)
+			for _, ns := range a.RWSets {
+				log.Printf("  namespace: %v, reads: %v, writes: %v",
+					ns.Namespace, len(ns.Reads), len(ns.Writes))
+			}
 		}
-	}()
+	}
+}
 
-	return beReg
+func integrityAlertListener(a *events.IntegrityAlert) {
+	log.Printf("Block integrity alert: %v", a)
 }
 
-func filteredBlockListener(ec *event.Client) fab.Registration {
-	// Register monitor filtered block event
-	fbeReg, fbeCh, err := ec.RegisterFilteredBlockEvent()
-	if err != nil {
-		log.Printf("Register filtered block event error: %v", err)
-	}
-	log.Println("Registered filtered block event")
-
-	// Receive filtered block event
-	go func() {
-		for e := range fbeCh {
-			log.Printf("Receive filterd block event:\nNumber: %v\nlen("+
-				"transactions): %v\nSourceURL: %v",
-				e.FilteredBlock.Number, len(e.FilteredBlock.
-					FilteredTransactions), e.SourceURL)
-
-			for i, tx := range e.FilteredBlock.FilteredTransactions {
-				log.Printf("tx index %d: type: %v, txid: %v, "+
-					"validation code: %v", i,
-					tx.Type, tx.Txid,
-					tx.TxValidationCode)
-			}
-			log.Println() // Just go print empty log for easy to read
-		}
-	}()
+func connectionListener(e *events.ConnectionEvent) {
+	log.Printf("Block event connection: state: %v, peer: %v, from: %v, to: %v, err: %v",
+		e.State, e.Peer, e.FromBlock, e.ToBlock, e.Err)
+}
 
-	return fbeReg
+func checkpointedBlockListener(e *fab.BlockEvent, p *events.TxProgress) error {
+	log.Printf("Receive checkpointed block event: number: %v, txs: %v",
+		e.Block.Header.Number, len(e.Block.Data.Data))
+	return nil
 }
 
-func txListener(ec *event.Client, txIDCh chan string) {
+func unifiedBlockListener(e *events.UnifiedBlockEvent) {
+	log.Printf("Receive %v block event:\nNumber: %v\nlen("+
+		"transactions): %v\nSourceURL: %v",
+		e.Mode, e.Number, len(e.Transactions), e.SourceURL)
+
+	for _, tx := range e.Transactions {
+		log.Printf("tx index %d: type: %v, txid: %v, "+
+			"validation code: %v, chaincode events: %v", tx.Index,
+			tx.Type, tx.TxID,
+			tx.ValidationCode, len(tx.ChaincodeEvents))
+	}
+	log.Println() // Just go print empty log for easy to read
+}
+
+func txListener(tracker *events.TxTracker, txIDCh chan string) {
 	log.Println("Transaction listener start")
 	defer log.Println("Transaction listener exit")
 
 	for id := range txIDCh {
-		// Register monitor transaction event
+		// Register monitor transaction event, it's unregistered after
+		// the status is received
 		log.Printf("Register transaction event for: %v", id)
-		txReg, txCh, err := ec.RegisterTxStatusEvent(id)
-		if err != nil {
+		if err := tracker.Track(id, txResultListener); err != nil {
 			log.Printf("Register transaction event error: %v", err)
-			continue
 		}
-		defer ec.Unregister(txReg)
-
-		// Receive transaction event
-		go func() {
-			for e := range txCh {
-				log.Printf("Receive transaction event: txid: %v, "+
-					"validation code: %v, block number: %v",
-					e.TxID,
-					e.TxValidationCode,
-					e.BlockNumber)
-			}
-		}()
 	}
+	tracker.Wait()
 }
 
-func chainCodeEventListener(c *cli.Client, ec *event.Client) fab.Registration {
-	eventName := ".*"
-	log.Printf("Listen chaincode event: %v", eventName)
-
-	var (
-		ccReg   fab.Registration
-		eventCh <-chan *fab.CCEvent
-		err     error
-	)
-	if c != nil {
-		log.Println("Using client to register chaincode event")
-		ccReg, eventCh, err = c.RegisterChaincodeEvent("mycc", eventName)
-	} else {
-		log.Println("Using event client to register chaincode event")
-		ccReg, eventCh, err = ec.RegisterChaincodeEvent("mycc", eventName)
-	}
-	if err != nil {
-		log.Printf("Register chaincode event error: %v", err.Error())
-		return nil
+func txResultListener(r *events.TxResult) {
+	if r.Err != nil {
+		log.Printf("Wait transaction event error: %v", r.Err)
+		return
 	}
+	log.Printf("Receive transaction event: txid: %v, "+
+		"validation code: %v, block number: %v",
+		r.Event.TxID,
+		r.Event.TxValidationCode,
+		r.Event.BlockNumber)
+}
 
-	// consume event
-	go func() {
-		for e := range eventCh {
-			log.Printf("Receive cc event, ccid: %v \neventName: %v\n"+
-				"payload: %v \ntxid: %v \nblock: %v \nsourceURL: %v\n",
-				e.ChaincodeID, e.EventName, string(e.Payload), e.TxID, e.BlockNumber, e.SourceURL)
-		}
-	}()
+func chainCodeEventListener(e *fab.CCEvent, payload interface{}) error {
+	log.Printf("Receive cc event, ccid: %v \neventName: %v\n"+
+		"payload: %v \ntxid: %v \nblock: %v \nsourceURL: %v\n",
+		e.ChaincodeID, e.EventName, string(payload.([]byte)), e.TxID, e.BlockNumber, e.SourceURL)
+	return nil
+}
+
+func transferListener(e *fab.CCEvent, payload interface{}) error {
+	t := payload.(*types.Transfer)
+	log.Printf("Receive transfer event: %v -> %v, amount: %v, balances: %v, txid: %v",
+		t.From, t.To, t.Amount, t.Balances, e.TxID)
+	return nil
+}
 
-	return ccReg
+func deletedListener(e *fab.CCEvent, payload interface{}) error {
+	d := payload.(*types.Deleted)
+	log.Printf("Receive deleted event: key: %v, txid: %v", d.Key, e.TxID)
+	return nil
 }
 
 // Install、Deploy、Invoke、Query、Upgrade
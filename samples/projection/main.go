@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/shitaibin/fabric-sdk-go-sample/cli"
+	"github.com/shitaibin/fabric-sdk-go-sample/events"
+	"github.com/shitaibin/fabric-sdk-go-sample/projection"
+)
+
+const (
+	org1CfgPath = "../../config/org1sdk-config.yaml"
+
+	dbPath = "/tmp/example02.db"
+)
+
+var rebuild = flag.Bool("rebuild", false, "rebuild projection from the genesis block")
+
+func main() {
+	flag.Parse()
+
+	org1Client := cli.New(org1CfgPath, "Org1", "Admin", "User1")
+	defer org1Client.Close()
+
+	// Projector should be closed after subscriber
+	p, err := projection.OpenSQLite(dbPath, org1Client.CCID)
+	if err != nil {
+		log.Panicf("Open projection db error: %v", err)
+	}
+	defer p.Close()
+
+	sub := events.NewSubscriber(org1Client.SDK, org1Client.OrgUser)
+	defer sub.Close()
+
+	if *rebuild {
+		log.Println("Rebuild projection from genesis block")
+		if err := p.Rebuild(sub, org1Client.ChannelID, 4); err != nil {
+			log.Panicf("Rebuild projection error: %v", err)
+		}
+		printBalances(p, "a", "b")
+	}
+
+	if _, err := p.Subscribe(sub, org1Client.ChannelID); err != nil {
+		log.Panicf("Subscribe projection error: %v", err)
+	}
+	if err := sub.Start(); err != nil {
+		log.Panicf("Start projection error: %v", err)
+	}
+	log.Printf("Projecting blocks of %s into %s, press Ctrl+C to exit", org1Client.ChannelID, dbPath)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+
+	printBalances(p, "a", "b")
+}
+
+func printBalances(p *projection.Projector, names ...string) {
+	for _, name := range names {
+		balance, ok, err := p.Balance(name)
+		if err != nil {
+			log.Printf("Query balance of %s error: %v", name, err)
+			continue
+		}
+		if !ok {
+			log.Printf("Account %s not found", name)
+			continue
+		}
+		log.Printf("Balance of %s: %d", name, balance)
+	}
+}